@@ -0,0 +1,143 @@
+package caches
+
+import (
+	"gaffeine/global"
+	"gaffeine/utils"
+)
+
+// ARCCache is an Adaptive Replacement Cache [1].
+// It keeps two resident lists, T1 for the keys seen once recently and T2 for the keys seen at least twice,
+// and two ghost lists, B1 and B2, which remember the keys recently evicted from T1 and T2 without their values.
+// A hit in B1 means T1 is too small, a hit in B2 means T2 is too small, so ARC moves the target size P of T1
+// accordingly and adapts between recency and frequency without any tuning, which makes it resistant to scans.
+//
+// [1] ARC: A Self-Tuning, Low Overhead Replacement Cache
+// https://www.usenix.org/legacy/events/fast03/tech/full_papers/megiddo/megiddo.pdf
+type ARCCache[K global.Key] struct {
+	MaximumSize int
+	P           int               // T1的目标大小，范围是[0, MaximumSize]
+	DataMap     map[K]*Element[K] // 包含 T1、T2、B1、B2 中所有的key，Element 的 pos 表示所在的列表
+	T1          *LRU[K]
+	T2          *LRU[K]
+	B1          *LRU[K]
+	B2          *LRU[K]
+}
+
+func NewARCCache[K global.Key](size int) *ARCCache[K] {
+	if size <= 0 {
+		size = 1
+	}
+	dataMap := make(map[K]*Element[K])
+	return &ARCCache[K]{
+		MaximumSize: size,
+		DataMap:     dataMap,
+		T1:          NewLRU(size, dataMap),
+		T2:          NewLRU(size, dataMap),
+		B1:          NewLRU(size, dataMap),
+		B2:          NewLRU(size, dataMap),
+	}
+}
+
+func (c *ARCCache[K]) Get(key K) (interface{}, bool) {
+	ele, ok := c.DataMap[key]
+	if !ok || (ele.pos != RecentPos && ele.pos != FrequentPos) { // 在ghost列表中，只有key没有value
+		return nil, false
+	}
+	c.moveTo(ele, c.T2, FrequentPos)
+	return ele.Value, true
+}
+
+// Set sets key and value to cache.
+// step:
+// 如果key在T1或者T2中，更新value，并移动到T2的first
+// 如果key在B1中，增大P，淘汰一个元素后，移动到T2的first
+// 如果key在B2中，减小P，淘汰一个元素后，移动到T2的first
+// 否则，保证 T1+B1 <= c 以及 T1+T2+B1+B2 <= 2c，然后插入到T1的first
+func (c *ARCCache[K]) Set(key K, value interface{}) {
+	if ele, ok := c.DataMap[key]; ok {
+		switch ele.pos {
+		case RecentPos, FrequentPos: // 表示key已经存在，更新value
+			ele.Value = value
+			c.moveTo(ele, c.T2, FrequentPos)
+			return
+		case RecentGhostPos: // B1命中，说明T1太小
+			c.P = int(utils.Min(c.MaximumSize, c.P+int(utils.Max(c.B2.Len()/c.B1.Len(), 1))))
+			c.replace(false)
+		case FrequentGhostPos: // B2命中，说明T2太小
+			c.P = int(utils.Max(0, c.P-int(utils.Max(c.B1.Len()/c.B2.Len(), 1))))
+			c.replace(true)
+		}
+		ele.Value = value
+		c.moveTo(ele, c.T2, FrequentPos)
+		return
+	}
+
+	if c.T1.Len()+c.B1.Len() == c.MaximumSize {
+		if c.T1.Len() < c.MaximumSize {
+			c.removeBack(c.B1)
+			c.replace(false)
+		} else { // B1是空的，直接淘汰T1中最久未使用的元素
+			c.removeBack(c.T1)
+		}
+	} else if total := c.T1.Len() + c.T2.Len() + c.B1.Len() + c.B2.Len(); total >= c.MaximumSize {
+		if total >= 2*c.MaximumSize {
+			c.removeBack(c.B2)
+		}
+		c.replace(false)
+	}
+
+	ele := c.T1.PushFront(value)
+	ele.Key = key
+	ele.pos = RecentPos
+	c.DataMap[key] = ele
+}
+
+// Len returns the number of entries in the cache, ghost keys excluded.
+func (c *ARCCache[K]) Len() int {
+	return c.T1.Len() + c.T2.Len()
+}
+
+// replace evicts the least recently used entry of T1 to B1 if T1 exceeds its target size P, otherwise the one of T2 to B2.
+// inB2 tells whether the key being set was found in B2.
+func (c *ARCCache[K]) replace(inB2 bool) {
+	if c.T1.Len() > 0 && (c.T1.Len() > c.P || (inB2 && c.T1.Len() == c.P)) {
+		c.moveTo(c.T1.Back(), c.B1, RecentGhostPos)
+	} else if c.T2.Len() > 0 {
+		c.moveTo(c.T2.Back(), c.B2, FrequentGhostPos)
+	}
+}
+
+// moveTo moves ele from its current list to the front of lru.
+func (c *ARCCache[K]) moveTo(ele *Element[K], lru *LRU[K], pos Position) {
+	if ele.pos == pos {
+		lru.MoveToFront(ele)
+		return
+	}
+	c.listOf(ele.pos).Remove(ele)
+	lru.InsertAtFront(ele)
+	ele.pos = pos
+	if pos == RecentGhostPos || pos == FrequentGhostPos {
+		ele.Value = nil // ghost只保留key
+	}
+}
+
+// removeBack removes the least recently used key of lru from the cache entirely.
+func (c *ARCCache[K]) removeBack(lru *LRU[K]) {
+	if back := lru.Back(); back != nil {
+		lru.Remove(back)
+		delete(c.DataMap, back.Key)
+	}
+}
+
+func (c *ARCCache[K]) listOf(pos Position) *LRU[K] {
+	switch pos {
+	case RecentPos:
+		return c.T1
+	case FrequentPos:
+		return c.T2
+	case RecentGhostPos:
+		return c.B1
+	default:
+		return c.B2
+	}
+}
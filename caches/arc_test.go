@@ -0,0 +1,113 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestARC_setAndGet(t *testing.T) {
+	cache := caches.NewARCCache[string](4)
+	cache.Set("key", 10)
+	assert.Equal(t, 1, cache.T1.Len())
+
+	v, ok := cache.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, 10, v.(int))
+	assert.Equal(t, 0, cache.T1.Len()) // 第二次访问，从T1移动到T2
+	assert.Equal(t, 1, cache.T2.Len())
+
+	cache.Set("key", 20)
+	v, _ = cache.Get("key")
+	assert.Equal(t, 20, v.(int))
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestARC_evictToGhost(t *testing.T) {
+	cache := caches.NewARCCache[int](2)
+	cache.Set(1, 1)
+	cache.Set(2, 2)
+	cache.Get(2)    // T1: 1; T2: 2
+	cache.Set(3, 3) // T1满了(P=0)，1 淘汰到 B1
+
+	_, ok := cache.Get(1)
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.B1.Len())
+	assert.Equal(t, 2, cache.Len())
+
+	// B1 命中，增大T1的目标大小P
+	cache.Set(1, 10)
+	assert.Equal(t, 1, cache.P)
+	v, ok := cache.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, 10, v.(int))
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestARC_ghostHitInB2(t *testing.T) {
+	cache := caches.NewARCCache[int](2)
+	cache.Set(1, 1)
+	cache.Get(1)
+	cache.Set(2, 2)
+	cache.Get(2)    // T2: 2, 1
+	cache.Set(3, 3) // 1 淘汰到 B2
+	assert.Equal(t, 1, cache.B2.Len())
+
+	cache.P = 1
+	cache.Set(1, 1) // B2 命中，减小P
+	assert.Equal(t, 0, cache.P)
+	_, ok := cache.Get(1)
+	assert.True(t, ok)
+}
+
+func TestARC_scanResistant(t *testing.T) {
+	const size = 100
+	arc := caches.NewARCCache[int](size)
+	lru := caches.NewPolicyCache[int](size, caches.NewLRUPolicy[int]())
+
+	// 热点数据被访问多次，进入T2
+	for _, cache := range []caches.Cache[int]{arc, lru} {
+		for i := 0; i < size/2; i++ {
+			cache.Set(i, i)
+			cache.Get(i)
+		}
+		// 一次性的扫描
+		for i := 1000; i < 1000+10*size; i++ {
+			cache.Set(i, i)
+		}
+	}
+
+	arcHits, lruHits := 0, 0
+	for i := 0; i < size/2; i++ {
+		if _, ok := arc.Get(i); ok {
+			arcHits++
+		}
+		if _, ok := lru.Get(i); ok {
+			lruHits++
+		}
+	}
+	assert.Equal(t, size/2, arcHits)
+	assert.Equal(t, 0, lruHits)
+}
+
+func TestARC_invariants(t *testing.T) {
+	const size = 50
+	cache := caches.NewARCCache[int](size)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100_000; i++ {
+		key := r.Intn(4 * size)
+		if _, ok := cache.Get(key); !ok {
+			cache.Set(key, key)
+		}
+		assert.LessOrEqual(t, cache.Len(), size)
+		assert.LessOrEqual(t, cache.T1.Len()+cache.B1.Len(), size)
+		assert.LessOrEqual(t, cache.Len()+cache.B1.Len()+cache.B2.Len(), 2*size)
+		assert.GreaterOrEqual(t, cache.P, 0)
+		assert.LessOrEqual(t, cache.P, size)
+		if t.Failed() {
+			return
+		}
+	}
+	assert.Equal(t, cache.Len()+cache.B1.Len()+cache.B2.Len(), len(cache.DataMap))
+}
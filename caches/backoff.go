@@ -0,0 +1,69 @@
+package caches
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is wrapped, with the last error of the loader, by the error of LoadingCache.Get while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("caches: circuit breaker is open")
+
+// loadFailure is the failed loads of a key, which are retried after an exponential backoff.
+type loadFailure struct {
+	err      error // 最后一次失败的错误
+	failures int   // 连续失败的次数
+	retryAt  time.Time
+}
+
+// backoff returns the delay before retrying the load after the given number of consecutive failures:
+// initial * 2^(failures-1), up to max.
+func backoff(initial, max time.Duration, failures int) time.Duration {
+	delay := initial
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// circuitBreaker trips after threshold consecutive failed loads of any keys. While it is open, no load is started,
+// and after cooldown it lets the loads through again: the next success closes it, the next failure opens it again.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int   // 连续失败的次数
+	err       error // 最后一次失败的错误
+	openUntil time.Time
+}
+
+// allow returns nil if a load can be started, otherwise an error wrapping ErrCircuitOpen and the last failure.
+func (b *circuitBreaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold && now.Before(b.openUntil) {
+		return fmt.Errorf("%w: %w", ErrCircuitOpen, b.err)
+	}
+	return nil
+}
+
+// record records the result of a load.
+func (b *circuitBreaker) record(now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures, b.err = 0, nil
+		return
+	}
+	b.failures++
+	b.err = err
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
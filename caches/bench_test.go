@@ -0,0 +1,213 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"gaffeine/global"
+	"gaffeine/workload"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Most caches are not safe for concurrent use, so the parallel benchmarks guard them with a mutex, which is the design
+// of hashicorp/golang-lru and groupcache. sharded is the ShardedCache, with a lock per shard like bigcache and
+// ristretto's store. syncmap, an unbounded sync.Map, is the baseline without eviction.
+// Run a part of the matrix with e.g. go test ./caches -run xxx -bench 'Cache/tinylfu/string/size=1000/mixed'
+
+const benchKeys = 1 << 16 // 预先生成的key的数量，访问时循环使用
+
+type benchDesign[K global.Key] struct {
+	name       string
+	newCache   func(size int) caches.Cache[K]
+	concurrent bool // cache本身是并发安全的，并行时不需要加锁
+}
+
+// guard returns cache guarded by a mutex unless it is safe for concurrent use.
+func (d benchDesign[K]) guard(cache caches.Cache[K]) caches.Cache[K] {
+	if d.concurrent {
+		return cache
+	}
+	return &lockedCache[K]{cache: cache}
+}
+
+func benchDesigns[K global.Key]() []benchDesign[K] {
+	designs := []benchDesign[K]{{name: "tinylfu", newCache: func(size int) caches.Cache[K] {
+		return caches.NewSizeCache[K](size)
+	}}, {name: "sharded", concurrent: true, newCache: func(size int) caches.Cache[K] {
+		return caches.NewShardedCache[K](size, 0)
+	}}}
+	for _, kind := range []caches.PolicyKind{caches.LRUPolicy, caches.ARCPolicy, caches.S3FIFOPolicy, caches.SIEVEPolicy} {
+		kind := kind
+		designs = append(designs, benchDesign[K]{name: kind.String(), newCache: func(size int) caches.Cache[K] {
+			return caches.NewCache[K](kind, size)
+		}})
+	}
+	return append(designs, benchDesign[K]{name: "syncmap", newCache: func(int) caches.Cache[K] {
+		return &syncMapCache[K]{}
+	}})
+}
+
+type lockedCache[K global.Key] struct {
+	mu    sync.Mutex
+	cache caches.Cache[K]
+}
+
+func (c *lockedCache[K]) Get(key K) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache.Get(key)
+}
+
+func (c *lockedCache[K]) Set(key K, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.Set(key, value)
+}
+
+type syncMapCache[K global.Key] struct {
+	m sync.Map
+}
+
+func (c *syncMapCache[K]) Get(key K) (interface{}, bool) { return c.m.Load(key) }
+func (c *syncMapCache[K]) Set(key K, value interface{})  { c.m.Store(key, value) }
+
+// zipfKeys returns benchKeys keys following a Zipf distribution over 4 times the cache size, so that the hot keys hit.
+func zipfKeys[K global.Key](size int, convert func(uint64) K) []K {
+	generator := workload.NewScrambledZipf(1, uint64(size*4), 0.99)
+	keys := make([]K, benchKeys)
+	for i := range keys {
+		keys[i] = convert(generator.Next())
+	}
+	return keys
+}
+
+func intKey(x uint64) int       { return int(x) }
+func stringKey(x uint64) string { return "key:" + strconv.FormatUint(x, 10) }
+
+type benchOp[K global.Key] struct {
+	name string
+	run  func(cache caches.Cache[K], key K, i int) // 第i次操作
+}
+
+func benchOps[K global.Key]() []benchOp[K] {
+	return []benchOp[K]{
+		{"get", func(cache caches.Cache[K], key K, i int) { cache.Get(key) }},
+		{"set", func(cache caches.Cache[K], key K, i int) { cache.Set(key, i) }},
+		{"mixed", func(cache caches.Cache[K], key K, i int) { // 3次读1次写
+			if i&3 == 0 {
+				cache.Set(key, i)
+			} else {
+				cache.Get(key)
+			}
+		}},
+	}
+}
+
+func BenchmarkCache(b *testing.B) {
+	for _, size := range []int{1_000, 100_000} {
+		intKeys, stringKeys := zipfKeys(size, intKey), zipfKeys(size, stringKey)
+		for _, design := range benchDesigns[int]() {
+			b.Run(design.name+"/int/size="+strconv.Itoa(size), func(b *testing.B) {
+				benchmarkCache(b, design, size, intKeys)
+			})
+		}
+		for _, design := range benchDesigns[string]() {
+			b.Run(design.name+"/string/size="+strconv.Itoa(size), func(b *testing.B) {
+				benchmarkCache(b, design, size, stringKeys)
+			})
+		}
+	}
+}
+
+// benchmarkCache runs every operation serially on the bare cache, and in parallel on the guarded cache with
+// 1 and 8 goroutines per GOMAXPROCS.
+func benchmarkCache[K global.Key](b *testing.B, design benchDesign[K], size int, keys []K) {
+	for _, op := range benchOps[K]() {
+		run := op.run
+		b.Run(op.name+"/serial", func(b *testing.B) {
+			cache := warmCache(design.newCache(size), keys)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				run(cache, keys[i&(benchKeys-1)], i)
+			}
+			reportOpsPerSecond(b)
+		})
+		for _, parallelism := range []int{1, 8} {
+			parallelism := parallelism
+			b.Run(op.name+"/parallel="+strconv.Itoa(parallelism), func(b *testing.B) {
+				cache := design.guard(warmCache(design.newCache(size), keys))
+				b.ReportAllocs()
+				b.SetParallelism(parallelism)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := nextKeyOffset()
+					for pb.Next() {
+						run(cache, keys[i&(benchKeys-1)], i)
+						i++
+					}
+				})
+				reportOpsPerSecond(b)
+			})
+		}
+	}
+}
+
+// warmCache fills cache with the keys, so that get measures hits as well as misses.
+func warmCache[K global.Key](cache caches.Cache[K], keys []K) caches.Cache[K] {
+	for i, key := range keys {
+		cache.Set(key, i)
+	}
+	return cache
+}
+
+func reportOpsPerSecond(b *testing.B) {
+	if seconds := b.Elapsed().Seconds(); seconds > 0 {
+		b.ReportMetric(float64(b.N)/seconds, "ops/s")
+	}
+}
+
+var (
+	keyOffsetMu sync.Mutex
+	keyOffset   int
+)
+
+// nextKeyOffset returns a different start offset to every goroutine, so that they do not access the same keys in lockstep.
+func nextKeyOffset() int {
+	keyOffsetMu.Lock()
+	defer keyOffsetMu.Unlock()
+	keyOffset += 7919
+	return keyOffset
+}
+
+func BenchmarkLRU_MoveToFront(b *testing.B) {
+	data := make(map[int]*caches.Element[int])
+	lru := caches.NewLRU(1024, data)
+	elements := make([]*caches.Element[int], 1024)
+	for i := range elements {
+		elements[i] = caches.WindowElement(i, i)
+		lru.InsertAtFront(elements[i])
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.MoveToFront(elements[(i*7919)&1023])
+	}
+	reportOpsPerSecond(b)
+}
+
+func BenchmarkLRU_InsertAndEvict(b *testing.B) {
+	data := make(map[int]*caches.Element[int])
+	lru := caches.NewLRU(1024, data)
+	elements := make([]*caches.Element[int], 2048)
+	for i := range elements {
+		elements[i] = caches.WindowElement(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.InsertAtFront(elements[i&2047]) // 超出容量之后，插入的元素是最久之前被淘汰的元素
+		lru.EvictBack()
+	}
+	reportOpsPerSecond(b)
+}
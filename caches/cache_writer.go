@@ -0,0 +1,238 @@
+package caches
+
+import (
+	"container/list"
+	"gaffeine/frequncy_sketch"
+	"gaffeine/global"
+	"sync"
+	"time"
+)
+
+// CacheWriter propagates the writes of a cache to a backing store, see ManagedConfig.Writer.
+type CacheWriter[K global.Key] interface {
+	// Write stores the value set for key.
+	Write(key K, value any) error
+	// Delete is called when key is removed from the cache. Only RemovalExplicit means that the key was invalidated
+	// by the user: a writer fronted by the cache usually ignores the other causes, see RemovalCause.WasEvicted.
+	Delete(key K, cause RemovalCause) error
+}
+
+// WriteErrorHandler is called with the writes given up by the CacheWriter.
+type WriteErrorHandler[K global.Key] func(key K, err error)
+
+const writeStripes = 64 // 同一个key的写按顺序进行，不同的key可以并发
+
+// cacheWriting passes the writes of a ManagedCache to its CacheWriter, synchronously (write-through) or by batches
+// in the background (write-behind).
+type cacheWriting[K global.Key] struct {
+	writer  CacheWriter[K]
+	onError WriteErrorHandler[K]
+	stripes [writeStripes]sync.Mutex // 保证store和cache中的写顺序相同
+	behind  *writeBehind[K]          // nil表示write-through
+}
+
+func (w *cacheWriting[K]) lock(key K) *sync.Mutex {
+	mu := &w.stripes[frequncy_sketch.Hash(key)&(writeStripes-1)]
+	mu.Lock()
+	return mu
+}
+
+// write writes value to the writer and, unless the writer failed, applies it to the cache with apply.
+// In write-behind mode, the write is queued after being applied. apply must not dispatch the notifications, which
+// would run the listener under the lock of key.
+func (w *cacheWriting[K]) write(key K, value any, apply func()) error {
+	defer w.lock(key).Unlock()
+	if w.behind != nil {
+		apply()
+		w.behind.enqueue(&writeOp[K]{key: key, value: value})
+		return nil
+	}
+	if err := w.writer.Write(key, value); err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// invalidate deletes key from the writer and, unless the writer failed, from the cache with apply.
+func (w *cacheWriting[K]) invalidate(key K, apply func()) error {
+	defer w.lock(key).Unlock()
+	if w.behind != nil {
+		apply()
+		w.behind.enqueue(&writeOp[K]{key: key, delete: true, cause: RemovalExplicit})
+		return nil
+	}
+	if err := w.writer.Delete(key, RemovalExplicit); err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// removed passes an automatic removal to the writer, after the fact. It is called by the dispatch of the notifications,
+// outside of the locks of the cache and of key, so that a slow writer does not block the writes of the key.
+func (w *cacheWriting[K]) removed(key K, cause RemovalCause) {
+	if w.behind != nil {
+		w.behind.enqueue(&writeOp[K]{key: key, delete: true, cause: cause})
+		return
+	}
+	if err := w.writer.Delete(key, cause); err != nil {
+		w.fail(key, err)
+	}
+}
+
+func (w *cacheWriting[K]) fail(key K, err error) {
+	if w.onError != nil {
+		w.onError(key, err)
+	}
+}
+
+func (w *cacheWriting[K]) flush() {
+	if w.behind != nil {
+		w.behind.flush(false)
+	}
+}
+
+func (w *cacheWriting[K]) close() {
+	if w.behind != nil {
+		w.behind.scheduler.Stop()
+		w.behind.flush(true)
+	}
+}
+
+// writeBehind coalesces the writes per key, and passes them to the writer in the order of their latest write, by
+// batches of at most batchSize keys, every interval or as soon as batchSize keys are pending. A failed write is
+// retried by the next batches, up to retries times before it is given up, unless the key was written again meanwhile.
+type writeBehind[K global.Key] struct {
+	writing   *cacheWriting[K]
+	batchSize int
+	retries   int
+	scheduler *Scheduler
+
+	mu      sync.Mutex
+	pending map[K]*list.Element // 值是*writeOp
+	order   *list.List          // 按最后一次写的顺序排列的*writeOp，最早的在前面
+
+	flushMu sync.Mutex // 一次只有一个flush
+}
+
+// writeOp is the latest write of a key waiting for the writer.
+type writeOp[K global.Key] struct {
+	key      K
+	value    any
+	delete   bool
+	cause    RemovalCause // delete的原因
+	attempts int          // 失败的次数
+}
+
+func newWriteBehind[K global.Key](writing *cacheWriting[K], interval time.Duration, batchSize, retries int) *writeBehind[K] {
+	b := &writeBehind[K]{
+		writing:   writing,
+		batchSize: batchSize,
+		retries:   retries,
+		pending:   make(map[K]*list.Element),
+		order:     list.New(),
+	}
+	b.scheduler = NewScheduler(interval, b.flushBatch)
+	return b
+}
+
+// enqueue replaces the pending write of key by op, which goes to the back of the queue. An automatic removal does
+// not replace a pending write, which still has to reach the store.
+func (b *writeBehind[K]) enqueue(op *writeOp[K]) {
+	b.mu.Lock()
+	if ele, ok := b.pending[op.key]; ok {
+		if op.delete && op.cause.WasEvicted() {
+			b.mu.Unlock()
+			return
+		}
+		b.order.Remove(ele)
+	}
+	b.pending[op.key] = b.order.PushBack(op)
+	full := len(b.pending) >= b.batchSize
+	b.mu.Unlock()
+	if full {
+		b.scheduler.Wake()
+	}
+}
+
+// flushBatch passes a batch of pending writes to the writer, and wakes the scheduler again if a full batch is left.
+func (b *writeBehind[K]) flushBatch() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.retry(b.write(b.take(), false))
+	b.mu.Lock()
+	full := len(b.pending) >= b.batchSize
+	b.mu.Unlock()
+	if full {
+		b.scheduler.Wake()
+	}
+}
+
+// flush passes all the pending writes to the writer, batch by batch. The failed writes are retried by the next flush,
+// except by the final one, which gives them up.
+func (b *writeBehind[K]) flush(final bool) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	n := b.order.Len() // 之后的写留给下一次flush，不会一直flush下去
+	b.mu.Unlock()
+	var failed []*writeOp[K]
+	for flushed := 0; flushed < n; {
+		batch := b.take()
+		if len(batch) == 0 {
+			break
+		}
+		flushed += len(batch)
+		failed = append(failed, b.write(batch, final)...)
+	}
+	b.retry(failed)
+}
+
+// take removes the batchSize oldest pending writes from the queue.
+func (b *writeBehind[K]) take() []*writeOp[K] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var batch []*writeOp[K]
+	for len(batch) < b.batchSize && b.order.Len() > 0 {
+		op := b.order.Remove(b.order.Front()).(*writeOp[K])
+		delete(b.pending, op.key)
+		batch = append(batch, op)
+	}
+	return batch
+}
+
+// write passes the batch to the writer in order, and returns the writes to retry.
+func (b *writeBehind[K]) write(batch []*writeOp[K], final bool) []*writeOp[K] {
+	var failed []*writeOp[K]
+	for _, op := range batch {
+		var err error
+		if op.delete {
+			err = b.writing.writer.Delete(op.key, op.cause)
+		} else {
+			err = b.writing.writer.Write(op.key, op.value)
+		}
+		if err == nil {
+			continue
+		}
+		op.attempts++
+		if final || op.attempts > b.retries {
+			b.writing.fail(op.key, err)
+		} else {
+			failed = append(failed, op)
+		}
+	}
+	return failed
+}
+
+// retry queues the failed writes again, before the writes queued meanwhile, unless their key was written again,
+// which makes them obsolete.
+func (b *writeBehind[K]) retry(failed []*writeOp[K]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := len(failed) - 1; i >= 0; i-- {
+		if op := failed[i]; b.pending[op.key] == nil {
+			b.pending[op.key] = b.order.PushFront(op)
+		}
+	}
+}
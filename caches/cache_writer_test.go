@@ -0,0 +1,295 @@
+package caches_test
+
+import (
+	"context"
+	"errors"
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// store is a CacheWriter keeping the written values in a map, failing the next failures writes.
+type store struct {
+	mu       sync.Mutex
+	values   map[string]any
+	deletes  []caches.RemovalCause
+	writes   int
+	failures int
+}
+
+func newStore() *store {
+	return &store{values: make(map[string]any)}
+}
+
+func (s *store) Write(key string, value any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("store down")
+	}
+	s.writes++
+	s.values[key] = value
+	return nil
+}
+
+func (s *store) Delete(key string, cause caches.RemovalCause) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("store down")
+	}
+	s.deletes = append(s.deletes, cause)
+	if cause == caches.RemovalExplicit {
+		delete(s.values, key)
+	}
+	return nil
+}
+
+func (s *store) fail(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+func (s *store) get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func (s *store) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.values)
+}
+
+func TestCacheWriter_writeThrough(t *testing.T) {
+	s := newStore()
+	var failed []string
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		Writer:       s,
+		OnWriteError: func(key string, err error) { failed = append(failed, key) },
+	})
+
+	cache.Set("a", 1)
+	value, _ := s.get("a")
+	assert.Equal(t, 1, value)
+	assert.Nil(t, cache.Invalidate("a"))
+	_, ok := s.get("a")
+	assert.False(t, ok)
+
+	cache.Set("b", 1)
+	s.fail(1)
+	cache.Set("b", 2) // writer失败，cache不变
+	value, _ = cache.Get("b")
+	assert.Equal(t, 1, value)
+	assert.Equal(t, []string{"b"}, failed)
+
+	s.fail(1)
+	assert.EqualError(t, cache.Invalidate("b"), "store down")
+	_, ok = cache.Get("b")
+	assert.True(t, ok)
+}
+
+func TestCacheWriter_writeThroughEvictions(t *testing.T) {
+	s := newStore()
+	cache := caches.NewManagedCache[string](4, caches.ManagedConfig[string]{Writer: s})
+	for i := 0; i < 20; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+	assert.Equal(t, 20, s.len()) // 淘汰不会从store中删除
+	assert.Equal(t, 20-cache.Len(), len(s.deletes))
+	for _, cause := range s.deletes {
+		assert.Equal(t, caches.RemovalSize, cause)
+	}
+}
+
+func TestCacheWriter_writeThroughEvictionsOutsideLock(t *testing.T) {
+	var cache *caches.ManagedCache[string]
+	s := &reentrantStore{store: newStore()}
+	cache = caches.NewManagedCache[string](4, caches.ManagedConfig[string]{Writer: s})
+	s.cache = cache
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			cache.Set(strconv.Itoa(i), i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the writer is blocked")
+	}
+	assert.NotEmpty(t, s.deletes)
+}
+
+// reentrantStore is a store which invalidates the evicted keys from the cache.
+type reentrantStore struct {
+	*store
+	cache *caches.ManagedCache[string]
+}
+
+func (s *reentrantStore) Delete(key string, cause caches.RemovalCause) error {
+	if cause.WasEvicted() {
+		s.cache.Invalidate(key) // 不持有key的锁
+	}
+	return s.store.Delete(key, cause)
+}
+
+func TestCacheWriter_writeBehindCoalesces(t *testing.T) {
+	s := newStore()
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		Writer:              s,
+		WriteBehindInterval: time.Hour,
+	})
+	defer cache.Close()
+
+	for i := 1; i <= 3; i++ {
+		cache.Set("a", i)
+	}
+	cache.Set("b", 1)
+	value, _ := cache.Get("a") // cache立即改变
+	assert.Equal(t, 3, value)
+	assert.Equal(t, 0, s.len())
+
+	assert.Nil(t, cache.CleanUp())
+	value, _ = s.get("a")
+	assert.Equal(t, 3, value)
+	assert.Equal(t, 2, s.writes) // 同一个key只写一次
+
+	assert.Nil(t, cache.Invalidate("a"))
+	assert.Nil(t, cache.CleanUp())
+	_, ok := s.get("a")
+	assert.False(t, ok)
+}
+
+func TestCacheWriter_writeBehindBatch(t *testing.T) {
+	s := newStore()
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		Writer:              s,
+		WriteBehindInterval: time.Hour,
+		WriteBehindBatch:    10,
+	})
+	defer cache.Close()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+	waitFor(t, func() bool { return s.len() == 10 })
+}
+
+// orderedStore is a CacheWriter logging the written keys, and the deleted keys prefixed by '-'. The first write blocks
+// until release is closed.
+type orderedStore struct {
+	mu      sync.Mutex
+	log     []string
+	once    sync.Once
+	first   chan struct{}
+	release chan struct{}
+}
+
+func (s *orderedStore) Write(key string, value any) error {
+	s.once.Do(func() {
+		close(s.first)
+		<-s.release
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, key)
+	return nil
+}
+
+func (s *orderedStore) Delete(key string, cause caches.RemovalCause) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = append(s.log, "-"+key)
+	return nil
+}
+
+func TestCacheWriter_writeBehindOrder(t *testing.T) {
+	s := &orderedStore{first: make(chan struct{}), release: make(chan struct{})}
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		Writer:              s,
+		WriteBehindInterval: time.Hour,
+		WriteBehindBatch:    3,
+	})
+	defer cache.Close()
+
+	for i := 0; i < 10; i++ {
+		cache.Set("k"+strconv.Itoa(i), i) // 第3个key唤醒scheduler，写入前3个key
+	}
+	<-s.first
+	assert.Nil(t, cache.Invalidate("k9")) // 还没有写入，合并成删除
+	cache.Set("k1", "again")              // 已经在写入的batch中，之后再写一次
+	close(s.release)
+	assert.Nil(t, cache.CleanUp())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8", "-k9", "k1"}, s.log)
+}
+
+func TestCacheWriter_writeBehindRetry(t *testing.T) {
+	s := newStore()
+	var failed []string
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		Writer:              s,
+		WriteBehindInterval: time.Hour,
+		WriteRetries:        2,
+		OnWriteError:        func(key string, err error) { failed = append(failed, key) },
+	})
+	defer cache.Close()
+
+	cache.Set("a", 1)
+	s.fail(2)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, cache.CleanUp())
+	}
+	value, _ := s.get("a") // 第三次成功
+	assert.Equal(t, 1, value)
+	assert.Empty(t, failed)
+
+	cache.Set("b", 1)
+	s.fail(3)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, cache.CleanUp())
+	}
+	_, ok := s.get("b")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"b"}, failed)
+}
+
+func TestCacheWriter_writeBehindKeepsEvictedWrites(t *testing.T) {
+	s := newStore()
+	cache := caches.NewManagedCache[string](4, caches.ManagedConfig[string]{
+		Writer:              s,
+		WriteBehindInterval: time.Hour,
+	})
+	for i := 0; i < 20; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+	assert.Nil(t, cache.Close()) // Close写入所有pending的写
+	assert.Equal(t, 20, s.len())
+	assert.Empty(t, s.deletes) // 淘汰不会覆盖还没有写入的值
+}
+
+func TestCacheWriter_loadedValuesAreNotWritten(t *testing.T) {
+	s := newStore()
+	cache := caches.NewLoadingCache[string](100, func(ctx context.Context, key string) (any, error) {
+		return key, nil
+	}, caches.LoadingConfig[string]{Managed: caches.ManagedConfig[string]{Writer: s}})
+
+	value, err := cache.Get(context.Background(), "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", value)
+	assert.Equal(t, 0, s.writes) // load的值来自store
+	cache.Set("b", 1)
+	assert.Equal(t, 1, s.writes)
+}
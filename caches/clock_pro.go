@@ -0,0 +1,193 @@
+package caches
+
+import "gaffeine/global"
+
+// ClockProCache is a cache evicting with CLOCK-Pro [1], an approximation of LIRS with the cost of CLOCK.
+// All pages, hot, resident cold and non-resident cold ones in their test period, are kept in a single clock,
+// and an access only sets a reference bit. Three hands sweep the clock:
+// HAND-cold evicts the unreferenced cold pages and promotes the referenced cold pages in their test period to hot,
+// HAND-hot demotes the unreferenced hot pages to cold, and HAND-test ends the test period of non-resident pages.
+// The target number of resident cold pages adapts: it grows when a page is accessed during its test period
+// and shrinks when a test period ends without access.
+//
+// This follows the implementation of the original authors, as ported by https://github.com/dgryski/go-clockpro.
+//
+// [1] CLOCK-Pro: An Effective Improvement of the CLOCK Replacement
+// https://www.usenix.org/legacy/events/usenix05/tech/general/full_papers/jiang/jiang.pdf
+type ClockProCache[K global.Key] struct {
+	MaximumSize int
+	ColdTarget  int               // 常驻cold page的目标数量
+	DataMap     map[K]*Element[K] // 所有的page，Element 的 pos 表示page的类型
+	Clock       *LRU[K]           // 环形链表，遍历时跳过哨兵
+
+	handHot, handCold, handTest    *Element[K]
+	countHot, countCold, countTest int
+}
+
+// NewClockProCache returns a cache of the given size, at least 2: with a single page, no page can be hot and the
+// hands would chase each other forever.
+func NewClockProCache[K global.Key](size int) *ClockProCache[K] {
+	if size < 2 {
+		size = 2
+	}
+	dataMap := make(map[K]*Element[K])
+	return &ClockProCache[K]{
+		MaximumSize: size,
+		ColdTarget:  size,
+		DataMap:     dataMap,
+		Clock:       NewLRU(0, dataMap),
+	}
+}
+
+func (c *ClockProCache[K]) Get(key K) (interface{}, bool) {
+	ele, ok := c.DataMap[key]
+	if !ok || ele.pos == TestPos {
+		return nil, false
+	}
+	ele.freq = 1
+	return ele.Value, true
+}
+
+// Set sets key and value to cache.
+// step:
+// 如果key是常驻的，更新value，设置reference标记
+// 如果key是处于测试期的非常驻page，增大ColdTarget，作为hot page重新加入
+// 否则，作为cold page加入
+func (c *ClockProCache[K]) Set(key K, value interface{}) {
+	ele, ok := c.DataMap[key]
+	if !ok {
+		ele = &Element[K]{Key: key, Value: value, pos: ColdPos}
+		c.add(ele)
+		c.countCold++
+		return
+	}
+	if ele.pos != TestPos { // 表示key已经存在，更新value
+		ele.Value = value
+		ele.freq = 1
+		return
+	}
+
+	// 在测试期内再次访问，说明cold page的空间太小
+	if c.ColdTarget < c.MaximumSize {
+		c.ColdTarget++
+	}
+	ele.Value, ele.pos, ele.freq = value, HotPos, 0
+	c.countTest--
+	c.remove(ele)
+	c.add(ele)
+	c.countHot++
+}
+
+// Len returns the number of entries in the cache, non-resident pages excluded.
+func (c *ClockProCache[K]) Len() int {
+	return c.countHot + c.countCold
+}
+
+// add makes room for ele, then inserts it just before HAND-hot, the head of the clock.
+func (c *ClockProCache[K]) add(ele *Element[K]) {
+	c.evict()
+	c.DataMap[ele.Key] = ele
+	if c.handHot == nil {
+		c.Clock.InsertAtFront(ele)
+		c.handHot, c.handCold, c.handTest = ele, ele, ele
+		return
+	}
+	c.Clock.insert(ele, c.handHot.prev)
+	if c.handCold == c.handHot {
+		c.handCold = c.prev(c.handCold)
+	}
+}
+
+// remove unlinks ele from the clock, moving back the hands pointing to it.
+func (c *ClockProCache[K]) remove(ele *Element[K]) {
+	delete(c.DataMap, ele.Key)
+	prev := c.prev(ele)
+	if prev == ele { // 最后一个page
+		prev = nil
+	}
+	if c.handHot == ele {
+		c.handHot = prev
+	}
+	if c.handCold == ele {
+		c.handCold = prev
+	}
+	if c.handTest == ele {
+		c.handTest = prev
+	}
+	c.Clock.Remove(ele)
+}
+
+func (c *ClockProCache[K]) evict() {
+	for c.MaximumSize <= c.countHot+c.countCold {
+		c.runHandCold()
+	}
+}
+
+func (c *ClockProCache[K]) runHandCold() {
+	ele := c.handCold
+	if ele.pos == ColdPos {
+		if ele.freq != 0 { // 在测试期内被访问过，变成hot page
+			ele.pos, ele.freq = HotPos, 0
+			c.countCold--
+			c.countHot++
+		} else { // 淘汰，但是保留key，进入测试期
+			ele.pos, ele.Value = TestPos, nil
+			c.countCold--
+			c.countTest++
+			for c.MaximumSize < c.countTest {
+				c.runHandTest()
+			}
+		}
+	}
+	c.handCold = c.next(c.handCold)
+	for c.MaximumSize-c.ColdTarget < c.countHot {
+		c.runHandHot()
+	}
+}
+
+func (c *ClockProCache[K]) runHandHot() {
+	if c.handHot == c.handTest {
+		c.runHandTest()
+	}
+	ele := c.handHot
+	if ele.pos == HotPos {
+		if ele.freq != 0 {
+			ele.freq = 0
+		} else {
+			ele.pos = ColdPos
+			c.countHot--
+			c.countCold++
+		}
+	}
+	c.handHot = c.next(c.handHot)
+}
+
+func (c *ClockProCache[K]) runHandTest() {
+	if c.handTest == c.handCold {
+		c.runHandCold()
+	}
+	if ele := c.handTest; ele.pos == TestPos { // 测试期结束，没有被访问过，说明cold page的空间太大
+		c.remove(ele)
+		c.countTest--
+		if c.ColdTarget > 1 {
+			c.ColdTarget--
+		}
+	}
+	c.handTest = c.next(c.handTest)
+}
+
+// next returns the element after ele in the clock, skipping the sentinel.
+func (c *ClockProCache[K]) next(ele *Element[K]) *Element[K] {
+	if ele.next == &c.Clock.root {
+		return c.Clock.root.next
+	}
+	return ele.next
+}
+
+// prev returns the element before ele in the clock, skipping the sentinel.
+func (c *ClockProCache[K]) prev(ele *Element[K]) *Element[K] {
+	if ele.prev == &c.Clock.root {
+		return c.Clock.root.prev
+	}
+	return ele.prev
+}
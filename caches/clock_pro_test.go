@@ -0,0 +1,83 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestClockPro_setAndGet(t *testing.T) {
+	cache := caches.NewClockProCache[string](10)
+	cache.Set("key", 10)
+	cache.Set("key", 20)
+	v, ok := cache.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, 20, v.(int))
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestClockPro_testPeriod(t *testing.T) {
+	cache := caches.NewClockProCache[int](2)
+	cache.Set(1, 1)
+	cache.Set(2, 2)
+	cache.Set(3, 3) // HAND-cold 指向 2，2 被淘汰，进入测试期
+
+	_, ok := cache.Get(2)
+	assert.False(t, ok)
+	assert.False(t, cache.DataMap[2].IsResident())
+	assert.Equal(t, 2, cache.Len())
+
+	// 测试期内再次访问，作为hot page加入
+	cache.Set(2, 10)
+	v, ok := cache.Get(2)
+	assert.True(t, ok)
+	assert.Equal(t, 10, v.(int))
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestClockPro_loop(t *testing.T) {
+	const size = 100
+	clockPro := loopHitRatio(caches.NewClockProCache[int](size), size+10, 20)
+	lru := loopHitRatio(caches.NewPolicyCache[int](size, caches.NewLRUPolicy[int]()), size+10, 20)
+
+	assert.Equal(t, 0.0, lru)
+	assert.Greater(t, clockPro, 0.5)
+}
+
+func TestClockPro_invariants(t *testing.T) {
+	const size = 50
+	cache := caches.NewClockProCache[int](size)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100_000; i++ {
+		key := r.Intn(10 * size)
+		if _, ok := cache.Get(key); !ok {
+			cache.Set(key, key)
+		}
+		assert.LessOrEqual(t, cache.Len(), size)
+		assert.LessOrEqual(t, len(cache.DataMap), 2*size)
+		assert.GreaterOrEqual(t, cache.ColdTarget, 1)
+		assert.LessOrEqual(t, cache.ColdTarget, size)
+		if t.Failed() {
+			return
+		}
+	}
+	assert.Equal(t, len(cache.DataMap), cache.Clock.Len())
+}
+
+func TestClockPro_smallSizes(t *testing.T) {
+	for _, size := range []int{-1, 0, 1, 2} {
+		cache := caches.NewClockProCache[int](size)
+		assert.Equal(t, 2, cache.MaximumSize)
+		r := rand.New(rand.NewSource(int64(size)))
+		for i := 0; i < 10000; i++ {
+			key := r.Intn(8)
+			if i%2 == 0 {
+				cache.Set(key, key)
+			} else if v, ok := cache.Get(key); ok {
+				assert.Equal(t, key, v)
+			}
+			assert.LessOrEqual(t, cache.Len(), 2)
+		}
+	}
+}
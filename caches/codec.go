@@ -0,0 +1,40 @@
+package caches
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Codec serializes the values of a cache, see TieredCache.
+type Codec[V any] interface {
+	Encode(value V) ([]byte, error)
+	Decode(data []byte) (V, error)
+}
+
+// GobCodec is a Codec using encoding/gob. Interface values need their concrete types registered with gob.Register.
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Encode(value V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[V]) Decode(data []byte) (V, error) {
+	var value V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// BytesCodec is a Codec of []byte values, which are stored as is.
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+func (BytesCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
@@ -0,0 +1,240 @@
+package caches
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gaffeine/global"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrCorrupted is returned by DiskStore.Get when a record does not match its checksum.
+var ErrCorrupted = errors.New("caches: corrupted record")
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+	storeSuffix   = ".store" // 保留一个store的文件名前缀
+	recordHeader  = 8        // crc32和长度
+)
+
+// DiskConfig configures a DiskStore. Zero values select the defaults.
+type DiskConfig struct {
+	MaxBytes    int64 // the bound of the size of the segments, 1GiB by default
+	SegmentSize int64 // the size of a segment before a new one is started, a sixteenth of MaxBytes by default
+}
+
+// DiskStore stores values on disk, in append-only log segments indexed in memory. Every Put appends a record
+// [crc32][length][value] to the active segment. When the segments grow past MaxBytes, the oldest segment is deleted
+// with the entries still in it, so the store is a FIFO of segments and never needs compaction.
+//
+// The store only lives as long as the process: its index is in memory, so its data does not survive a reopen, and
+// Close deletes its files. Every store names its files with its own unique prefix, reserved by a file
+// segment-<id>.store, so several stores can share a directory. A crashed process leaves its files behind, which no
+// store reads or deletes.
+// It is safe for concurrent use.
+type DiskStore[K global.Key] struct {
+	dir    string
+	config DiskConfig
+	id     *os.File // 保留segment-<id>-前缀的文件
+	prefix string
+
+	mu       sync.Mutex
+	index    map[K]diskLocation[K]
+	segments []*segment[K] // 从旧到新，最后一个是active segment
+	removing []*segment[K] // trim没有删除成功的文件，Close时重试
+	nextID   int
+	size     int64 // 所有segment的字节数
+}
+
+type diskLocation[K global.Key] struct {
+	segment *segment[K]
+	offset  int64
+	length  int32
+}
+
+type segment[K global.Key] struct {
+	file *os.File
+	size int64
+	keys []K // 写入这个segment的key，删除segment时用于清理index
+}
+
+// NewDiskStore opens a store in dir, which is created if needed.
+func NewDiskStore[K global.Key](dir string, config DiskConfig) (*DiskStore[K], error) {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 1 << 30
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = config.MaxBytes / 16
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	id, err := os.CreateTemp(dir, segmentPrefix+"*"+storeSuffix) // O_EXCL，两个store不会得到相同的id
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(filepath.Base(id.Name()), storeSuffix) + "-"
+	return &DiskStore[K]{dir: dir, config: config, id: id, prefix: prefix, index: make(map[K]diskLocation[K])}, nil
+}
+
+// Put stores value for key, replacing the previous value.
+func (s *DiskStore[K]) Put(key K, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return ErrClosed
+	}
+	record := make([]byte, recordHeader+len(value))
+	binary.LittleEndian.PutUint32(record, crc32.ChecksumIEEE(value))
+	binary.LittleEndian.PutUint32(record[4:], uint32(len(value)))
+	copy(record[recordHeader:], value)
+
+	active, err := s.activeSegment(int64(len(record)))
+	if err != nil {
+		return err
+	}
+	if _, err := active.file.WriteAt(record, active.size); err != nil {
+		return err
+	}
+	s.index[key] = diskLocation[K]{segment: active, offset: active.size, length: int32(len(value))}
+	active.keys = append(active.keys, key)
+	active.size += int64(len(record))
+	s.size += int64(len(record))
+	return s.trim()
+}
+
+// activeSegment returns the segment to append n bytes to, starting a new one if the active segment is full.
+func (s *DiskStore[K]) activeSegment(n int64) (*segment[K], error) {
+	if len(s.segments) > 0 {
+		active := s.segments[len(s.segments)-1]
+		if active.size == 0 || active.size+n <= s.config.SegmentSize {
+			return active, nil
+		}
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf("%s%06d%s", s.prefix, s.nextID, segmentSuffix))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	active := &segment[K]{file: file}
+	s.nextID++
+	s.segments = append(s.segments, active)
+	return active, nil
+}
+
+// trim deletes the oldest segments until the store fits in MaxBytes, keeping the active segment. A segment whose file
+// cannot be removed is dropped from the store all the same, and its removal is retried by Close.
+func (s *DiskStore[K]) trim() error {
+	for s.size > s.config.MaxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		s.segments = s.segments[1:]
+		s.size -= oldest.size
+		for _, key := range oldest.keys {
+			if location, ok := s.index[key]; ok && location.segment == oldest {
+				delete(s.index, key)
+			}
+		}
+		if err := s.removeSegment(oldest); err != nil {
+			s.removing = append(s.removing, oldest)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSegment closes and removes the file of seg. It can be retried after a failure.
+func (s *DiskStore[K]) removeSegment(seg *segment[K]) error {
+	err := seg.file.Close()
+	if errors.Is(err, os.ErrClosed) { // 上一次删除的时候已经关闭了
+		err = nil
+	}
+	if removeErr := os.Remove(seg.file.Name()); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+		return errors.Join(err, removeErr)
+	}
+	return err
+}
+
+// Get returns the value of key, or returns false if key is not stored.
+func (s *DiskStore[K]) Get(key K) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	location, ok := s.index[key]
+	if !ok {
+		return nil, false, nil
+	}
+	record := make([]byte, recordHeader+int(location.length))
+	if _, err := location.segment.file.ReadAt(record, location.offset); err != nil {
+		return nil, false, err
+	}
+	value := record[recordHeader:]
+	if binary.LittleEndian.Uint32(record) != crc32.ChecksumIEEE(value) ||
+		binary.LittleEndian.Uint32(record[4:]) != uint32(location.length) {
+		delete(s.index, key)
+		return nil, false, ErrCorrupted
+	}
+	return value, true, nil
+}
+
+// Delete removes key from the index. Its record stays on disk until its segment is deleted.
+func (s *DiskStore[K]) Delete(key K) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.index[key]
+	delete(s.index, key)
+	return ok
+}
+
+// Len returns the number of keys stored.
+func (s *DiskStore[K]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// Size returns the number of bytes of the segments, including the records of the deleted and replaced keys.
+func (s *DiskStore[K]) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Segments returns the names of the segment files, from the oldest.
+func (s *DiskStore[K]) Segments() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.segments))
+	for _, seg := range s.segments {
+		names = append(names, filepath.Base(seg.file.Name()))
+	}
+	return names
+}
+
+// Close deletes the files of the store, including the segments trim failed to delete. Closing a closed store returns
+// ErrClosed.
+func (s *DiskStore[K]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return ErrClosed
+	}
+	s.index = nil
+	var errs []error
+	for _, seg := range append(s.removing, s.segments...) {
+		if err := s.removeSegment(seg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.segments, s.removing = nil, nil
+	if err := s.id.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := os.Remove(s.id.Name()); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
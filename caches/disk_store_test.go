@@ -0,0 +1,139 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestDiskStore_putGet(t *testing.T) {
+	store, err := caches.NewDiskStore[string](t.TempDir(), caches.DiskConfig{})
+	assert.Nil(t, err)
+	defer store.Close()
+
+	assert.Nil(t, store.Put("a", []byte("1")))
+	assert.Nil(t, store.Put("b", []byte("2")))
+	assert.Nil(t, store.Put("a", []byte("3")))
+	value, ok, err := store.Get("a")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("3"), value)
+	assert.Equal(t, 2, store.Len())
+	assert.Equal(t, int64(3*9), store.Size()) // 被替换的record还在磁盘上
+
+	assert.True(t, store.Delete("a"))
+	_, ok, err = store.Get("a")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestDiskStore_maxBytes(t *testing.T) {
+	store, err := caches.NewDiskStore[int](t.TempDir(), caches.DiskConfig{MaxBytes: 1000, SegmentSize: 200})
+	assert.Nil(t, err)
+	defer store.Close()
+
+	value := make([]byte, 92) // 每个record 100字节，每个segment两个record
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, store.Put(i, value))
+		assert.LessOrEqual(t, store.Size(), int64(1000))
+	}
+	assert.Equal(t, 5, len(store.Segments()))
+	assert.Equal(t, 10, store.Len())
+	_, ok, _ := store.Get(89) // 最旧的segment被删除了
+	assert.False(t, ok)
+	_, ok, _ = store.Get(90)
+	assert.True(t, ok)
+}
+
+func TestDiskStore_corrupted(t *testing.T) {
+	dir := t.TempDir()
+	store, err := caches.NewDiskStore[string](dir, caches.DiskConfig{})
+	assert.Nil(t, err)
+	defer store.Close()
+
+	assert.Nil(t, store.Put("a", []byte("value")))
+	name := filepath.Join(dir, store.Segments()[0])
+	data, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	data[len(data)-1] ^= 0xff
+	assert.Nil(t, os.WriteFile(name, data, 0o644))
+
+	_, ok, err := store.Get("a")
+	assert.Equal(t, caches.ErrCorrupted, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestDiskStore_trimRetriedByClose(t *testing.T) {
+	dir := t.TempDir()
+	store, err := caches.NewDiskStore[string](dir, caches.DiskConfig{MaxBytes: 64, SegmentSize: 32})
+	assert.Nil(t, err)
+	value := make([]byte, 20) // 每个segment一个28字节的记录
+	assert.Nil(t, store.Put("a", value))
+	assert.Nil(t, store.Put("b", value))
+
+	// 把最旧的segment替换成非空的目录，删除失败
+	oldest := filepath.Join(dir, store.Segments()[0])
+	assert.Nil(t, os.Remove(oldest))
+	assert.Nil(t, os.Mkdir(oldest, 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(oldest, "file"), nil, 0o644))
+
+	assert.NotNil(t, store.Put("c", value))
+	assert.Equal(t, 2, len(store.Segments()))
+	assert.Equal(t, int64(56), store.Size())
+	_, ok, _ := store.Get("a")
+	assert.False(t, ok)
+
+	assert.Nil(t, os.Remove(filepath.Join(oldest, "file")))
+	assert.Nil(t, store.Close()) // 重试删除
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestDiskStore_close(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "segment-000007.log"), []byte("old"), 0o644))
+	store, err := caches.NewDiskStore[int](dir, caches.DiskConfig{})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, store.Put(i, []byte(strconv.Itoa(i))))
+	}
+	assert.Equal(t, 1, len(store.Segments()))
+	assert.Regexp(t, `^segment-\d+-000000\.log$`, store.Segments()[0])
+
+	assert.Nil(t, store.Close())
+	assert.Equal(t, caches.ErrClosed, store.Close())
+	assert.Equal(t, caches.ErrClosed, store.Put(1, nil))
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries)) // 只删除自己的文件
+	assert.Equal(t, "segment-000007.log", entries[0].Name())
+}
+
+func TestDiskStore_sharedDir(t *testing.T) {
+	dir := t.TempDir()
+	first, err := caches.NewDiskStore[int](dir, caches.DiskConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, first.Put(1, []byte("first")))
+	second, err := caches.NewDiskStore[int](dir, caches.DiskConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, second.Put(1, []byte("second")))
+	assert.NotEqual(t, first.Segments(), second.Segments())
+
+	value, ok, err := first.Get(1) // 第二个store没有删除第一个store的segment
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "first", string(value))
+	assert.Nil(t, second.Close())
+	value, _, _ = first.Get(1)
+	assert.Equal(t, "first", string(value))
+	assert.Nil(t, first.Close())
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,102 @@
+package caches_test
+
+import (
+	"encoding/json"
+	"flag"
+	"gaffeine/caches"
+	"gaffeine/simulator"
+	"gaffeine/trace"
+	"gaffeine/workload"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// The golden hit ratios are regenerated with: go test ./caches -run TestHitRatio -update-golden
+var updateGolden = flag.Bool("update-golden", false, "rewrite testdata/hit_ratio.golden.json with the current hit ratios")
+
+const (
+	goldenPath        = "testdata/hit_ratio.golden.json"
+	hitRatioCacheSize = 1000
+	hitRatioRequests  = 200_000
+	hitRatioTolerance = 0.03
+	// SizeCache 在频率相同时随机淘汰，固定seed使结果可以重现
+	hitRatioSeed = 1
+)
+
+// hitRatioWorkloads are the seeded workloads of the regression suite.
+var hitRatioWorkloads = map[string]func() trace.Reader{
+	// 热点数据服从Zipf分布
+	"zipf": func() trace.Reader {
+		return workload.Trace(workload.NewZipf(1, 100_000, 0.99), hitRatioRequests)
+	},
+	// 一半的请求是一次性的扫描，热点数据不能被扫描冲掉
+	"scan": func() trace.Reader {
+		return workload.Trace(workload.NewMix(2, []float64{1, 1}, workload.NewZipf(3, 100_000, 0.99), workload.NewScan(1<<40)), hitRatioRequests)
+	},
+	// 循环比cache稍大，LRU的命中率为0
+	"loop": func() trace.Reader {
+		return workload.Trace(workload.NewLoop(hitRatioCacheSize*6/5), hitRatioRequests)
+	},
+}
+
+var hitRatioPolicies = []caches.PolicyKind{
+	caches.TinyLFUPolicy, caches.LRUPolicy, caches.LFUPolicy, caches.FIFOPolicy, caches.ARCPolicy,
+	caches.S3FIFOPolicy, caches.SIEVEPolicy, caches.LIRSPolicy, caches.ClockProPolicy,
+}
+
+// measureHitRatios returns the hit ratio of every policy on every workload, keyed by workload then by policy.
+func measureHitRatios(t *testing.T) map[string]map[string]float64 {
+	ratios := make(map[string]map[string]float64)
+	for name, newTrace := range hitRatioWorkloads {
+		results, err := simulator.SimulateOptions(newTrace(), hitRatioPolicies, []int{hitRatioCacheSize},
+			simulator.Options{Seed: hitRatioSeed})
+		assert.Nil(t, err)
+		ratios[name] = make(map[string]float64)
+		for _, result := range results {
+			ratios[name][result.Policy] = result.HitRatio
+		}
+	}
+	return ratios
+}
+
+// writeGolden records the hit ratios.
+func writeGolden(t *testing.T, ratios map[string]map[string]float64) {
+	data, err := json.MarshalIndent(ratios, "", "  ")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(goldenPath, append(data, '\n'), 0o644))
+}
+
+func TestHitRatio(t *testing.T) {
+	ratios := measureHitRatios(t)
+
+	for name := range hitRatioWorkloads {
+		tinyLFU, lru := ratios[name][caches.TinyLFUPolicy.String()], ratios[name][caches.LRUPolicy.String()]
+		assert.Greater(t, tinyLFU, lru, "W-TinyLFU %.4f does not beat LRU %.4f on %s", tinyLFU, lru, name)
+	}
+
+	if *updateGolden {
+		writeGolden(t, ratios)
+		return
+	}
+	data, err := os.ReadFile(goldenPath)
+	if !assert.Nil(t, err, "run with -update-golden to create %s", goldenPath) {
+		return
+	}
+	golden := make(map[string]map[string]float64)
+	assert.Nil(t, json.Unmarshal(data, &golden))
+	for name, policies := range ratios {
+		for policy, actual := range policies {
+			expected, ok := golden[name][policy]
+			if !assert.True(t, ok, "%s on %s has no golden hit ratio, run with -update-golden", policy, name) {
+				continue
+			}
+			// 只有命中率下降才算回归，明显的提升提示更新golden
+			assert.GreaterOrEqual(t, actual, expected-hitRatioTolerance,
+				"hit ratio of %s on %s regressed from %.4f to %.4f", policy, name, expected, actual)
+			if actual > expected+hitRatioTolerance {
+				t.Logf("hit ratio of %s on %s improved from %.4f to %.4f, run with -update-golden", policy, name, expected, actual)
+			}
+		}
+	}
+}
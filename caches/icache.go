@@ -1,8 +1,30 @@
 package caches
 
-import "gaffeine/global"
+import (
+	"gaffeine/frequncy_sketch"
+	"gaffeine/global"
+)
 
 type Cache[K global.Key] interface {
 	Get(key K) (interface{}, bool)
 	Set(key K, value interface{})
 }
+
+// Inspector is implemented by caches that can report the popularity of their keys.
+type Inspector[K global.Key] interface {
+	// HeavyHitters returns the hottest keys with their estimated access counts, ordered from the hottest,
+	// or nil if heavy hitters are not tracked.
+	HeavyHitters() []frequncy_sketch.HeavyHitter[K]
+}
+
+// Maintainer is implemented by caches with maintenance, see ManagedCache.
+type Maintainer interface {
+	// CleanUp runs the pending maintenance synchronously.
+	CleanUp() error
+	// Close stops the background maintenance and releases the cache. Afterwards, the operations returning an error
+	// return ErrClosed, Get misses and Set is ignored.
+	Close() error
+	// Err returns ErrClosed once the cache is closed, and nil before, so that the callers of Get and Set can tell
+	// a closed cache from a miss.
+	Err() error
+}
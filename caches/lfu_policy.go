@@ -0,0 +1,88 @@
+package caches
+
+import "gaffeine/global"
+
+// lfuBucket holds the keys accessed freq times, ordered from the most recently used.
+type lfuBucket[K global.Key] struct {
+	freq       int
+	entries    *LRU[K]
+	prev, next *lfuBucket[K]
+}
+
+// LFUEvictionPolicy evicts the least frequently used key, and the least recently used one among them.
+// All operations are O(1): the keys are kept in buckets of the same frequency, and the buckets
+// form a list ordered by frequency, so an access only moves a key to the next bucket [1].
+//
+// [1] An O(1) algorithm for implementing the LFU cache eviction scheme
+// http://dhruvbird.com/lfu.pdf
+type LFUEvictionPolicy[K global.Key] struct {
+	root lfuBucket[K] // sentinel bucket, root.next has the lowest frequency
+}
+
+func NewLFUPolicy[K global.Key]() *LFUEvictionPolicy[K] {
+	p := &LFUEvictionPolicy[K]{}
+	p.root.next = &p.root
+	p.root.prev = &p.root
+	return p
+}
+
+func (p *LFUEvictionPolicy[K]) OnAccess(ele *Element[K]) {
+	bucket := ele.bucket
+	next := bucket.next
+	if next == &p.root || next.freq != bucket.freq+1 {
+		next = p.insertBucket(bucket.freq+1, bucket)
+	}
+	bucket.entries.Remove(ele)
+	next.entries.InsertAtFront(ele)
+	ele.bucket = next
+	if bucket.entries.Len() == 0 {
+		p.removeBucket(bucket)
+	}
+}
+
+func (p *LFUEvictionPolicy[K]) OnInsert(ele *Element[K]) {
+	bucket := p.root.next
+	if bucket == &p.root || bucket.freq != 1 {
+		bucket = p.insertBucket(1, &p.root)
+	}
+	bucket.entries.InsertAtFront(ele)
+	ele.bucket = bucket
+}
+
+func (p *LFUEvictionPolicy[K]) OnRemove(ele *Element[K]) {
+	bucket := ele.bucket
+	bucket.entries.Remove(ele)
+	ele.bucket = nil
+	if bucket.entries.Len() == 0 {
+		p.removeBucket(bucket)
+	}
+}
+
+func (p *LFUEvictionPolicy[K]) Victim() (*Element[K], bool) {
+	if bucket := p.root.next; bucket != &p.root {
+		return bucket.entries.Back(), true
+	}
+	return nil, false
+}
+
+// Frequency returns the number of times ele was inserted or accessed since it was inserted, 0 if it was removed.
+func (p *LFUEvictionPolicy[K]) Frequency(ele *Element[K]) int {
+	if ele.bucket != nil {
+		return ele.bucket.freq
+	}
+	return 0
+}
+
+// insertBucket inserts a new bucket of frequency freq after at.
+func (p *LFUEvictionPolicy[K]) insertBucket(freq int, at *lfuBucket[K]) *lfuBucket[K] {
+	bucket := &lfuBucket[K]{freq: freq, entries: NewLRU[K](0, nil), prev: at, next: at.next}
+	at.next.prev = bucket
+	at.next = bucket
+	return bucket
+}
+
+func (p *LFUEvictionPolicy[K]) removeBucket(bucket *lfuBucket[K]) {
+	bucket.prev.next = bucket.next
+	bucket.next.prev = bucket.prev
+	bucket.prev, bucket.next = nil, nil // avoid memory leaks
+}
@@ -0,0 +1,201 @@
+package caches
+
+import "gaffeine/global"
+
+// LIRSCache is a cache evicting with LIRS [1].
+// Keys are ranked by their inter-reference recency (IRR), the number of other keys accessed between their last two accesses.
+// Keys with a low IRR (LIR) occupy most of the cache, while keys with a high IRR (HIR) only get a small part
+// of it, about 1%, managed as a FIFO queue Q. A stack S records the recency of LIR keys and of recently accessed HIR keys,
+// including non-resident ones, and a HIR key accessed again while still in S becomes LIR, replacing the LIR key at the
+// bottom of S. Unlike LRU, LIRS therefore keeps most of a loop slightly larger than the cache instead of none of it.
+//
+// A resident HIR key in both S and Q has an element in each list, the element in Q holding the value.
+// The non-resident keys are bounded to twice the size of the cache.
+//
+// [1] LIRS: An Efficient Low Inter-reference Recency Set Replacement Policy to Improve Buffer Cache Performance
+// https://dl.acm.org/doi/10.1145/511399.511340
+type LIRSCache[K global.Key] struct {
+	MaximumSize int
+	LIRSize     int               // LIR key的最大数量
+	HIRSize     int               // 常驻的HIR key的最大数量，即Q的大小
+	DataMap     map[K]*Element[K] // S中的key，LIR key的element保存value
+	QueueMap    map[K]*Element[K] // Q中的key，保存常驻HIR key的value
+	Stack       *LRU[K]           // S：front是栈顶（最近访问的），back是栈底，栈底总是LIR key
+	Queue       *LRU[K]           // Q：front是最近加入的，back是下一个淘汰的
+
+	lirCount         int // LIR key的数量
+	nonResidentCount int // S中非常驻HIR key的数量
+}
+
+// NewLIRSCache returns a cache of the given size, at least 2 so that there is room for a LIR key and a HIR key.
+func NewLIRSCache[K global.Key](size int) *LIRSCache[K] {
+	if size < 2 {
+		size = 2
+	}
+	hirSize := size / 100
+	if hirSize <= 0 {
+		hirSize = 1
+	}
+	dataMap, queueMap := make(map[K]*Element[K]), make(map[K]*Element[K])
+	return &LIRSCache[K]{
+		MaximumSize: size,
+		LIRSize:     size - hirSize,
+		HIRSize:     hirSize,
+		DataMap:     dataMap,
+		QueueMap:    queueMap,
+		Stack:       NewLRU(0, dataMap),
+		Queue:       NewLRU(hirSize, queueMap),
+	}
+}
+
+func (c *LIRSCache[K]) Get(key K) (interface{}, bool) {
+	holder := c.access(key)
+	if holder == nil {
+		return nil, false
+	}
+	return holder.Value, true
+}
+
+// Set sets key and value to cache.
+// step:
+// 如果key是常驻的，更新value，按照一次访问处理
+// 如果LIR key没有满，作为LIR key插入
+// 否则，淘汰Q的back，如果key在S中（非常驻HIR），变成LIR key，栈底的LIR key变成HIR key；否则作为HIR key插入到S和Q
+func (c *LIRSCache[K]) Set(key K, value interface{}) {
+	if holder := c.access(key); holder != nil { // 表示key已经存在，更新value
+		holder.Value = value
+		return
+	}
+
+	ele, inStack := c.DataMap[key]
+	if c.lirCount < c.LIRSize { // 冷启动阶段，直接作为LIR key
+		if inStack {
+			c.nonResidentCount--
+			c.Stack.MoveToFront(ele)
+		} else {
+			ele = c.push(c.Stack, c.DataMap, key)
+		}
+		ele.Value, ele.pos = value, LIRPos
+		c.lirCount++
+		return
+	}
+
+	if c.Queue.Len() >= c.HIRSize {
+		c.evict()
+	}
+	if inStack { // 非常驻的HIR key再次访问，它的IRR比栈底的LIR key小
+		c.nonResidentCount--
+		ele.Value, ele.pos = value, LIRPos
+		c.Stack.MoveToFront(ele)
+		c.lirCount++
+		c.demoteBottom()
+	} else {
+		c.push(c.Stack, c.DataMap, key).pos = HIRPos
+		holder := c.push(c.Queue, c.QueueMap, key)
+		holder.Value, holder.pos = value, HIRPos
+	}
+	c.limitNonResident()
+}
+
+// Len returns the number of entries in the cache, non-resident keys excluded.
+func (c *LIRSCache[K]) Len() int {
+	return c.lirCount + c.Queue.Len()
+}
+
+// access records an access of key and returns the element holding its value, nil if key is not resident.
+func (c *LIRSCache[K]) access(key K) *Element[K] {
+	ele, inStack := c.DataMap[key]
+	if inStack && ele.pos == LIRPos {
+		wasBottom := c.Stack.Back() == ele
+		c.Stack.MoveToFront(ele)
+		if wasBottom {
+			c.prune()
+		}
+		return ele
+	}
+
+	holder, inQueue := c.QueueMap[key]
+	if !inQueue {
+		return nil
+	}
+	if inStack { // 常驻的HIR key在S中再次访问，变成LIR key
+		ele.Value, ele.pos = holder.Value, LIRPos
+		c.Stack.MoveToFront(ele)
+		c.Queue.Remove(holder)
+		delete(c.QueueMap, key)
+		c.lirCount++
+		c.demoteBottom()
+		return ele
+	}
+	c.push(c.Stack, c.DataMap, key).pos = HIRPos
+	c.Queue.MoveToFront(holder)
+	return holder
+}
+
+// evict removes the resident HIR key at the back of Q, which stays in S as a non-resident key if it is there.
+func (c *LIRSCache[K]) evict() {
+	holder := c.Queue.Back()
+	if holder == nil {
+		return
+	}
+	c.Queue.Remove(holder)
+	delete(c.QueueMap, holder.Key)
+	if ele, ok := c.DataMap[holder.Key]; ok {
+		ele.pos = NonResidentPos
+		c.nonResidentCount++
+	}
+}
+
+// demoteBottom turns the LIR key at the bottom of S into a resident HIR key if there are too many LIR keys.
+func (c *LIRSCache[K]) demoteBottom() {
+	if c.lirCount <= c.LIRSize {
+		return
+	}
+	c.prune() // 保证栈底是LIR key，不会把HIR key移到Q中
+	bottom := c.Stack.Back()
+	c.Stack.Remove(bottom)
+	delete(c.DataMap, bottom.Key)
+	c.lirCount--
+
+	holder := c.push(c.Queue, c.QueueMap, bottom.Key)
+	holder.Value, holder.pos = bottom.Value, HIRPos
+	c.prune()
+}
+
+// prune removes the HIR keys at the bottom of S, so that the bottom is a LIR key.
+func (c *LIRSCache[K]) prune() {
+	for bottom := c.Stack.Back(); bottom != nil && bottom.pos != LIRPos; bottom = c.Stack.Back() {
+		c.Stack.Remove(bottom)
+		delete(c.DataMap, bottom.Key)
+		if bottom.pos == NonResidentPos {
+			c.nonResidentCount--
+		}
+	}
+}
+
+// limitNonResident removes the oldest non-resident keys from S once they exceed twice the size of the cache,
+// down to the size of the cache, so that the cost of the scan is amortized.
+func (c *LIRSCache[K]) limitNonResident() {
+	if c.nonResidentCount <= 2*c.MaximumSize {
+		return
+	}
+	for ele := c.Stack.Back(); ele != nil && c.nonResidentCount > c.MaximumSize; {
+		prev := ele.prev
+		if ele.pos == NonResidentPos {
+			c.Stack.Remove(ele)
+			delete(c.DataMap, ele.Key)
+			c.nonResidentCount--
+		}
+		if prev == &c.Stack.root {
+			break
+		}
+		ele = prev
+	}
+}
+
+func (c *LIRSCache[K]) push(lru *LRU[K], data map[K]*Element[K], key K) *Element[K] {
+	ele := lru.PushFront(nil)
+	ele.Key = key
+	data[key] = ele
+	return ele
+}
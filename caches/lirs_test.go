@@ -0,0 +1,138 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// loopHitRatio replays a loop over loopSize keys, as in the looping access pattern of the LIRS paper,
+// and returns the hit ratio after the first pass.
+func loopHitRatio(cache caches.Cache[int], loopSize, passes int) float64 {
+	hits, requests := 0, 0
+	for pass := 0; pass < passes; pass++ {
+		for key := 0; key < loopSize; key++ {
+			_, ok := cache.Get(key)
+			if !ok {
+				cache.Set(key, key)
+			}
+			if pass > 0 {
+				requests++
+				if ok {
+					hits++
+				}
+			}
+		}
+	}
+	return float64(hits) / float64(requests)
+}
+
+func TestLIRS_construct(t *testing.T) {
+	cache := caches.NewLIRSCache[int](1000)
+	assert.Equal(t, 990, cache.LIRSize)
+	assert.Equal(t, 10, cache.HIRSize)
+
+	cache = caches.NewLIRSCache[int](10)
+	assert.Equal(t, 9, cache.LIRSize)
+	assert.Equal(t, 1, cache.HIRSize)
+}
+
+func TestLIRS_setAndGet(t *testing.T) {
+	cache := caches.NewLIRSCache[string](10)
+	cache.Set("key", 10)
+	cache.Set("key", 20)
+	v, ok := cache.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, 20, v.(int))
+	assert.True(t, cache.DataMap["key"].IsLIR())
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestLIRS_hirBecomesLIR(t *testing.T) {
+	cache := caches.NewLIRSCache[int](3) // LIRSize=2, HIRSize=1
+	cache.Set(1, 1)
+	cache.Set(2, 2) // 1、2 是LIR
+	cache.Set(3, 3) // 3 是常驻的HIR，在S和Q中
+	assert.True(t, cache.DataMap[3].IsHIR())
+	assert.True(t, cache.QueueMap[3].IsHIR())
+
+	cache.Get(2)
+	cache.Set(4, 4) // 淘汰Q中的3，3 在S中变成非常驻HIR
+	_, ok := cache.Get(3)
+	assert.False(t, ok)
+	assert.True(t, cache.DataMap[3].IsHIR())
+	assert.False(t, cache.DataMap[3].IsResident())
+
+	// 3 的IRR比栈底的LIR key 1 小，3 变成LIR，1 变成HIR
+	cache.Set(3, 30)
+	assert.True(t, cache.DataMap[3].IsLIR())
+	v, ok := cache.Get(3)
+	assert.True(t, ok)
+	assert.Equal(t, 30, v.(int))
+	_, inStack := cache.DataMap[1]
+	assert.False(t, inStack) // 1 被剪枝出S
+	assert.True(t, cache.QueueMap[1].IsHIR())
+	assert.Equal(t, 3, cache.Len())
+}
+
+func TestLIRS_loop(t *testing.T) {
+	const size = 100
+	lirs := loopHitRatio(caches.NewLIRSCache[int](size), size+10, 20)
+	lru := loopHitRatio(caches.NewPolicyCache[int](size, caches.NewLRUPolicy[int]()), size+10, 20)
+
+	// 循环比cache稍大时，LRU总是淘汰下一个要访问的key，命中率为0
+	// LIRS 保留了LIR key，命中率接近 LIRSize / loopSize
+	assert.Equal(t, 0.0, lru)
+	assert.Greater(t, lirs, 0.8)
+}
+
+func TestLIRS_invariants(t *testing.T) {
+	const size = 50
+	cache := caches.NewLIRSCache[int](size)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100_000; i++ {
+		key := r.Intn(10 * size)
+		if _, ok := cache.Get(key); !ok {
+			cache.Set(key, key)
+		}
+		assert.LessOrEqual(t, cache.Len(), size)
+		assert.LessOrEqual(t, cache.Queue.Len(), cache.HIRSize)
+		assert.LessOrEqual(t, cache.Stack.Len(), 3*size+cache.LIRSize+cache.HIRSize)
+		if bottom := cache.Stack.Back(); bottom != nil {
+			assert.True(t, bottom.IsLIR())
+		}
+		if t.Failed() {
+			return
+		}
+	}
+}
+
+func TestLIRS_smallSizes(t *testing.T) {
+	cache := caches.NewLIRSCache[int](1)
+	assert.Equal(t, 2, cache.MaximumSize)
+	assert.Equal(t, 1, cache.LIRSize)
+	cache.Set(1, 1)
+	cache.Set(2, 2)
+	cache.Set(1, 1)
+	if value, ok := cache.Get(2); ok {
+		assert.Equal(t, 2, value)
+	}
+
+	for _, size := range []int{0, 1, 2, 3} {
+		cache := caches.NewLIRSCache[int](size)
+		r := rand.New(rand.NewSource(int64(size)))
+		for i := 0; i < 10000; i++ {
+			key := r.Intn(8)
+			if value, ok := cache.Get(key); ok {
+				assert.Equal(t, key, value)
+			} else {
+				cache.Set(key, key)
+			}
+			assert.LessOrEqual(t, cache.Len(), cache.MaximumSize)
+			if bottom := cache.Stack.Back(); bottom != nil {
+				assert.True(t, bottom.IsLIR())
+			}
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package caches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gaffeine/global"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrLoadTimeout is returned by LoadingCache.Get when the load took longer than the load timeout.
+	ErrLoadTimeout = errors.New("caches: load timed out")
+	// ErrLoaderPanic is wrapped by the LoaderPanicError returned when the loader panicked.
+	ErrLoaderPanic = errors.New("caches: loader panicked")
+	// ErrNotFound is returned, or wrapped, by a Loader to report that the key does not exist.
+	// LoadingCache caches it as a negative entry, see LoadingConfig.NegativeTTL.
+	ErrNotFound = errors.New("caches: not found")
+)
+
+// Loader loads the value of a missing key, typically from a remote service. It should return promptly once ctx is
+// done, which happens when the load times out or when every caller waiting for the key gave up.
+type Loader[K global.Key] func(ctx context.Context, key K) (any, error)
+
+// LoaderPanicError is the error of a load whose loader panicked. It is returned to every caller waiting for the key.
+type LoaderPanicError struct {
+	Value any    // the value passed to panic
+	Stack []byte // the stack of the loader when it panicked
+}
+
+func (e *LoaderPanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrLoaderPanic, e.Value)
+}
+
+func (e *LoaderPanicError) Unwrap() error {
+	return ErrLoaderPanic
+}
+
+// LoadingCache is a ManagedCache whose Get loads the missing keys with a Loader.
+//
+// Concurrent Gets of the same missing key share a single load, which runs in its own goroutine under a context
+// bounded by the load timeout rather than by the context of any caller: a caller whose context is done stops
+// waiting, and the load is cancelled only when every caller stopped waiting. The successful loads are cached, and
+// so are the loads failing with ErrNotFound if negative caching is enabled.
+//
+// The other failed loads can be retried after an exponential backoff, and the loads of the whole cache can be
+// stopped by a circuit breaker while the loader keeps failing, see LoadingConfig.
+type LoadingCache[K global.Key] struct {
+	*ManagedCache[K]
+	loader            Loader[K]
+	loadTimeout       time.Duration    // 0表示不超时
+	negative          *ManagedCache[K] // 缓存ErrNotFound，nil表示不缓存
+	refreshAfterWrite time.Duration    // 0表示不刷新
+
+	failures       *ManagedCache[K] // 值是*loadFailure，nil表示没有backoff
+	backoffInitial time.Duration
+	backoffMax     time.Duration
+	breaker        *circuitBreaker // nil表示没有circuit breaker
+
+	loadMu sync.Mutex
+	calls  map[K]*loadCall // 正在进行的load
+}
+
+type loadCall struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int           // 等待结果的调用者个数，由loadMu保护
+	done    chan struct{} // load结束之后关闭
+	value   any
+	err     error
+	stale   atomic.Bool // load期间key被写入了，或者load超时了，结果不再写入cache
+	settled bool        // load结束或者超时了，之后的超时不再记录失败，由loadMu保护
+}
+
+// LoadingConfig configures a LoadingCache. Zero values disable the features.
+type LoadingConfig[K global.Key] struct {
+	Managed     ManagedConfig[K]
+	LoadTimeout time.Duration // bounds every load
+	// NegativeTTL enables negative caching: a load failing with ErrNotFound is cached for NegativeTTL, usually
+	// shorter than the expiration of the values. The negative entries hold no value, so rather than competing with
+	// the values for the size of the cache, they are bounded separately by NegativeSize, a tenth of the size of the
+	// cache by default. They are not passed to the removal listener.
+	NegativeTTL  time.Duration
+	NegativeSize int
+	// RefreshAfterWrite reloads, in the background, an entry read RefreshAfterWrite after it was set, while Get keeps
+	// returning the current value. It should be shorter than the expiration, so that the entries are refreshed
+	// before they expire.
+	RefreshAfterWrite time.Duration
+	// BackoffInitial enables the exponential backoff of the failed loads: after n consecutive failed loads of a key,
+	// Get returns the last error without loading for BackoffInitial * 2^(n-1), up to BackoffMax, which defaults to
+	// BackoffInitial. The count is reset by a successful load, by Set and Invalidate, and when the key did not fail for
+	// twice BackoffMax.
+	BackoffInitial time.Duration
+	BackoffMax     time.Duration
+	// BreakerThreshold enables the circuit breaker: after BreakerThreshold consecutive failed loads of any keys, no
+	// load is started for BreakerCooldown. Meanwhile Get returns an error wrapping ErrCircuitOpen for the missing
+	// keys, and serves the entries due for a refresh without refreshing them.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// NewLoadingCache returns a cache of the given size loading the missing keys with loader. If there is a scheduler,
+// the cache must be closed when done.
+func NewLoadingCache[K global.Key](size int, loader Loader[K], config LoadingConfig[K]) *LoadingCache[K] {
+	c := &LoadingCache[K]{
+		ManagedCache:      NewManagedCache[K](size, config.Managed),
+		loader:            loader,
+		loadTimeout:       config.LoadTimeout,
+		refreshAfterWrite: config.RefreshAfterWrite,
+		calls:             make(map[K]*loadCall),
+	}
+	if config.NegativeTTL > 0 {
+		negativeSize := config.NegativeSize
+		if negativeSize <= 0 {
+			negativeSize = size / 10
+		}
+		c.negative = c.newInternalCache(negativeSize, config.NegativeTTL, config.Managed.SchedulerInterval)
+	}
+	if config.BackoffInitial > 0 {
+		c.backoffInitial = config.BackoffInitial
+		c.backoffMax = config.BackoffMax
+		if c.backoffMax < c.backoffInitial {
+			c.backoffMax = c.backoffInitial
+		}
+		c.failures = c.newInternalCache(size, c.backoffMax+c.backoffMax, config.Managed.SchedulerInterval)
+	}
+	if config.BreakerThreshold > 0 {
+		c.breaker = &circuitBreaker{threshold: config.BreakerThreshold, cooldown: config.BreakerCooldown}
+	}
+	return c
+}
+
+// newInternalCache returns a cache of the entries of c which are not values, sharing its clock.
+func (c *LoadingCache[K]) newInternalCache(size int, ttl, schedulerInterval time.Duration) *ManagedCache[K] {
+	cache := NewManagedCache[K](size, ManagedConfig[K]{ExpireAfterWrite: ttl, SchedulerInterval: schedulerInterval})
+	cache.Now = func() time.Time { return c.Now() }
+	return cache
+}
+
+// Get returns the value of key, loading it if it is missing. It returns ctx.Err() if ctx is done before the load,
+// ErrLoadTimeout if the load timed out, a LoaderPanicError if the loader panicked, and otherwise the error of the
+// loader, which is also returned without loading while it is cached as a negative entry or the key backs off.
+func (c *LoadingCache[K]) Get(ctx context.Context, key K) (any, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	if value, writtenAt, ok := c.getEntry(key); ok {
+		if c.refreshAfterWrite > 0 && !c.Now().Before(writtenAt.Add(c.refreshAfterWrite)) {
+			c.refresh(key)
+		}
+		return value, nil
+	}
+	if c.negative != nil {
+		if err, ok := c.negative.Get(key); ok {
+			return nil, err.(error)
+		}
+	}
+	if err := c.checkLoad(key); err != nil {
+		return nil, err
+	}
+	call := c.join(key, true)
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-call.ctx.Done(): // 超时，不等待忽略ctx的loader
+		select {
+		case <-call.done:
+			return call.value, call.err
+		default:
+			c.expire(key, call)
+			return nil, ErrLoadTimeout
+		}
+	case <-ctx.Done():
+		c.leave(key, call)
+		return nil, ctx.Err()
+	}
+}
+
+// GetIfPresent returns the value of key without loading it.
+func (c *LoadingCache[K]) GetIfPresent(key K) (any, bool) {
+	return c.ManagedCache.Get(key)
+}
+
+// Set sets the value of key, replacing its negative entry and resetting its backoff. The result of a load of key
+// in progress is returned to its callers but not cached.
+func (c *LoadingCache[K]) Set(key K, value interface{}) {
+	c.supersede(key)
+	c.ManagedCache.Set(key, value)
+	c.forEachInternalCache(func(cache *ManagedCache[K]) { cache.Invalidate(key) })
+}
+
+// setLoaded sets a loaded value, which comes from the store and is not passed to the writer.
+func (c *LoadingCache[K]) setLoaded(key K, value any, call *loadCall) {
+	if c.closed.Load() {
+		return
+	}
+	c.setIf(key, value, func() bool { return !call.stale.Load() })
+	c.forEachInternalCache(func(cache *ManagedCache[K]) { cache.Invalidate(key) })
+}
+
+// Invalidate removes key, or its negative entry, from the cache, and resets its backoff. The result of a load of
+// key in progress is returned to its callers but not cached.
+func (c *LoadingCache[K]) Invalidate(key K) error {
+	c.supersede(key)
+	c.forEachInternalCache(func(cache *ManagedCache[K]) { cache.Invalidate(key) })
+	return c.ManagedCache.Invalidate(key)
+}
+
+// CleanUp runs the maintenance synchronously, see ManagedCache.CleanUp.
+func (c *LoadingCache[K]) CleanUp() error {
+	c.forEachInternalCache(func(cache *ManagedCache[K]) { cache.CleanUp() })
+	return c.ManagedCache.CleanUp()
+}
+
+// Close closes the cache, see ManagedCache.Close.
+func (c *LoadingCache[K]) Close() error {
+	c.forEachInternalCache(func(cache *ManagedCache[K]) { cache.Close() })
+	return c.ManagedCache.Close()
+}
+
+func (c *LoadingCache[K]) forEachInternalCache(f func(cache *ManagedCache[K])) {
+	for _, cache := range []*ManagedCache[K]{c.negative, c.failures} {
+		if cache != nil {
+			f(cache)
+		}
+	}
+}
+
+// checkLoad returns the error to return instead of loading key, while it backs off or the circuit breaker is open.
+func (c *LoadingCache[K]) checkLoad(key K) error {
+	if c.failures != nil {
+		if failure, ok := c.failures.Get(key); ok && c.Now().Before(failure.(*loadFailure).retryAt) {
+			return failure.(*loadFailure).err
+		}
+	}
+	if c.breaker != nil {
+		return c.breaker.allow(c.Now())
+	}
+	return nil
+}
+
+// refresh reloads key in the background, unless it backs off or the circuit breaker is open. A failed refresh
+// keeps the current value.
+func (c *LoadingCache[K]) refresh(key K) {
+	if c.checkLoad(key) == nil {
+		c.join(key, false)
+	}
+}
+
+// join waits for the load of key in progress, or starts it. A load without waiter is not cancelled by leave.
+func (c *LoadingCache[K]) join(key K, wait bool) *loadCall {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	call, ok := c.calls[key]
+	if !ok {
+		call = &loadCall{done: make(chan struct{})}
+		if c.loadTimeout > 0 {
+			call.ctx, call.cancel = context.WithTimeout(context.Background(), c.loadTimeout)
+		} else {
+			call.ctx, call.cancel = context.WithCancel(context.Background())
+		}
+		c.calls[key] = call
+		go c.load(key, call)
+	}
+	if wait {
+		call.waiters++
+	}
+	return call
+}
+
+// leave stops waiting for call, and cancels it if nobody waits for it anymore. A later Get starts a new load.
+func (c *LoadingCache[K]) leave(key K, call *loadCall) {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	call.waiters--
+	if call.waiters == 0 {
+		c.forget(key, call)
+		call.cancel()
+	}
+}
+
+func (c *LoadingCache[K]) forget(key K, call *loadCall) {
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+}
+
+// supersede keeps the load of key in progress, if any, from caching its result, because key is being written. A
+// later Get starts a new load.
+func (c *LoadingCache[K]) supersede(key K) {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	if call, ok := c.calls[key]; ok {
+		call.stale.Store(true) // 在写入key之前标记，setLoaded要么先写入要么不写入
+		delete(c.calls, key)
+	}
+}
+
+// expire gives up call after its load timed out, even if the loader ignores its context: the failure is recorded
+// now, and the next Get starts a new load once the backoff is over.
+func (c *LoadingCache[K]) expire(key K, call *loadCall) {
+	c.loadMu.Lock()
+	settled := call.settled
+	call.settled = true
+	c.forget(key, call)
+	c.loadMu.Unlock()
+	call.stale.Store(true)
+	if !settled {
+		c.recordFailure(key, ErrLoadTimeout)
+		if c.breaker != nil {
+			c.breaker.record(c.Now(), ErrLoadTimeout)
+		}
+	}
+}
+
+func (c *LoadingCache[K]) load(key K, call *loadCall) {
+	defer call.cancel()
+	value, err := c.callLoader(call.ctx, key)
+	if err != nil && errors.Is(call.ctx.Err(), context.DeadlineExceeded) {
+		err = ErrLoadTimeout
+	}
+	c.loadMu.Lock()
+	expired := call.settled // Get超时的时候已经记录过了
+	call.settled = true
+	c.loadMu.Unlock()
+	switch {
+	case expired:
+	case err == nil:
+		c.setLoaded(key, value, call) // 先写入cache再删除call，之后的Get不会再load
+	case errors.Is(err, ErrNotFound):
+		if c.negative != nil && !call.stale.Load() {
+			c.negative.Set(key, err)
+		}
+	case errors.Is(call.ctx.Err(), context.Canceled): // 调用者都不等待了，不算失败
+	default:
+		c.recordFailure(key, err)
+	}
+	if c.breaker != nil && !expired && !errors.Is(call.ctx.Err(), context.Canceled) {
+		if errors.Is(err, ErrNotFound) { // loader正常返回了
+			c.breaker.record(c.Now(), nil)
+		} else {
+			c.breaker.record(c.Now(), err)
+		}
+	}
+	c.loadMu.Lock()
+	c.forget(key, call)
+	c.loadMu.Unlock()
+	call.value, call.err = value, err
+	close(call.done)
+}
+
+// recordFailure postpones the next load of key after a failure.
+func (c *LoadingCache[K]) recordFailure(key K, err error) {
+	if c.failures == nil {
+		return
+	}
+	failure := &loadFailure{err: err, failures: 1}
+	if previous, ok := c.failures.Get(key); ok {
+		failure.failures += previous.(*loadFailure).failures
+	}
+	failure.retryAt = c.Now().Add(backoff(c.backoffInitial, c.backoffMax, failure.failures))
+	c.failures.Set(key, failure)
+}
+
+// callLoader calls the loader, turning a panic into a LoaderPanicError.
+func (c *LoadingCache[K]) callLoader(ctx context.Context, key K) (value any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, &LoaderPanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return c.loader(ctx, key)
+}
@@ -0,0 +1,368 @@
+package caches_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadingCache_get(t *testing.T) {
+	var loads atomic.Int32
+	cache := caches.NewLoadingCache[string](100, func(ctx context.Context, key string) (any, error) {
+		loads.Add(1)
+		if key == "missing" {
+			return nil, errors.New("no such key")
+		}
+		return key + "!", nil
+	}, caches.LoadingConfig[string]{})
+
+	for i := 0; i < 3; i++ {
+		value, err := cache.Get(context.Background(), "a")
+		assert.Nil(t, err)
+		assert.Equal(t, "a!", value)
+	}
+	assert.Equal(t, int32(1), loads.Load())
+
+	for i := 0; i < 2; i++ { // 失败的load不缓存
+		_, err := cache.Get(context.Background(), "missing")
+		assert.EqualError(t, err, "no such key")
+	}
+	assert.Equal(t, int32(3), loads.Load())
+	_, ok := cache.GetIfPresent("missing")
+	assert.False(t, ok)
+}
+
+func TestLoadingCache_sharedLoad(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		loads.Add(1)
+		<-release
+		return key * 2, nil
+	}, caches.LoadingConfig[int]{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.Get(context.Background(), 21)
+			assert.Nil(t, err)
+			assert.Equal(t, 42, value)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestLoadingCache_timeout(t *testing.T) {
+	cancelled := make(chan struct{})
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}, caches.LoadingConfig[int]{LoadTimeout: 10 * time.Millisecond})
+
+	_, err := cache.Get(context.Background(), 1)
+	assert.Equal(t, caches.ErrLoadTimeout, err)
+	<-cancelled
+}
+
+func TestLoadingCache_timeoutIgnoredByLoader(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		<-release // 忽略ctx
+		return key, nil
+	}, caches.LoadingConfig[int]{LoadTimeout: 10 * time.Millisecond})
+
+	_, err := cache.Get(context.Background(), 1)
+	assert.True(t, errors.Is(err, caches.ErrLoadTimeout))
+}
+
+func TestLoadingCache_retryAfterTimeout(t *testing.T) {
+	clock := newFakeClock()
+	var loads atomic.Int32
+	release, finished := make(chan struct{}), make(chan struct{})
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		if loads.Add(1) == 1 {
+			defer close(finished)
+			<-release // 忽略ctx
+			return "late", nil
+		}
+		return "fresh", nil
+	}, caches.LoadingConfig[int]{LoadTimeout: 10 * time.Millisecond, BackoffInitial: time.Second})
+	cache.Now = clock.Now
+
+	_, err := cache.Get(context.Background(), 1)
+	assert.Equal(t, caches.ErrLoadTimeout, err)
+	_, err = cache.Get(context.Background(), 1) // backoff
+	assert.Equal(t, caches.ErrLoadTimeout, err)
+	assert.Equal(t, int32(1), loads.Load())
+
+	clock.Advance(time.Second) // 不等待超时的load，重新load
+	value, err := cache.Get(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", value)
+	assert.Equal(t, int32(2), loads.Load())
+
+	close(release)
+	<-finished
+	time.Sleep(10 * time.Millisecond)
+	value, _ = cache.GetIfPresent(1)
+	assert.Equal(t, "fresh", value)
+}
+
+func TestLoadingCache_writeDuringLoad(t *testing.T) {
+	for _, write := range []string{"set", "invalidate"} {
+		t.Run(write, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+				close(started)
+				<-release
+				return "loaded", nil
+			}, caches.LoadingConfig[int]{})
+
+			values := make(chan any, 1)
+			go func() {
+				value, _ := cache.Get(context.Background(), 1)
+				values <- value
+			}()
+			<-started
+			if write == "set" {
+				cache.Set(1, "written")
+			} else {
+				assert.Nil(t, cache.Invalidate(1))
+			}
+			close(release)
+			assert.Equal(t, "loaded", <-values) // 等待的调用者仍然拿到load的结果
+
+			value, ok := cache.GetIfPresent(1)
+			if write == "set" {
+				assert.True(t, ok)
+				assert.Equal(t, "written", value)
+			} else {
+				assert.False(t, ok)
+			}
+		})
+	}
+}
+
+func TestLoadingCache_cancelWaiters(t *testing.T) {
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}, caches.LoadingConfig[int]{})
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		go func(ctx context.Context) {
+			_, err := cache.Get(ctx, 1)
+			errs <- err
+		}(ctx)
+	}
+	<-started
+	time.Sleep(10 * time.Millisecond) // 两个调用者都在等待
+
+	cancel1()
+	assert.Equal(t, context.Canceled, <-errs)
+	select {
+	case <-cancelled:
+		t.Fatal("the load was cancelled while a caller was waiting for it")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel2() // 最后一个调用者取消，load也被取消
+	assert.Equal(t, context.Canceled, <-errs)
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the load was not cancelled")
+	}
+}
+
+func TestLoadingCache_loaderPanic(t *testing.T) {
+	release := make(chan struct{})
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		<-release
+		panic("boom")
+	}, caches.LoadingConfig[int]{})
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := cache.Get(context.Background(), 1)
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < 3; i++ { // 每个调用者都收到panic
+		err := <-errs
+		assert.True(t, errors.Is(err, caches.ErrLoaderPanic))
+		var panicErr *caches.LoaderPanicError
+		assert.True(t, errors.As(err, &panicErr))
+		assert.Equal(t, "boom", panicErr.Value)
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+}
+
+func TestLoadingCache_closed(t *testing.T) {
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		return key, nil
+	}, caches.LoadingConfig[int]{})
+	assert.Nil(t, cache.Close())
+	_, err := cache.Get(context.Background(), 1)
+	assert.Equal(t, caches.ErrClosed, err)
+}
+
+func TestLoadingCache_negativeCaching(t *testing.T) {
+	var loads atomic.Int32
+	cache := caches.NewLoadingCache[string](100, func(ctx context.Context, key string) (any, error) {
+		loads.Add(1)
+		return nil, fmt.Errorf("user %s: %w", key, caches.ErrNotFound)
+	}, caches.LoadingConfig[string]{NegativeTTL: 50 * time.Millisecond})
+
+	for i := 0; i < 3; i++ { // 只load一次
+		_, err := cache.Get(context.Background(), "a")
+		assert.True(t, errors.Is(err, caches.ErrNotFound))
+		assert.EqualError(t, err, "user a: caches: not found")
+	}
+	assert.Equal(t, int32(1), loads.Load())
+	_, ok := cache.GetIfPresent("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len()) // 不占用cache的容量
+
+	assert.Nil(t, cache.Invalidate("a"))
+	cache.Get(context.Background(), "a")
+	assert.Equal(t, int32(2), loads.Load())
+
+	cache.Set("a", 1) // Set覆盖negative entry
+	value, err := cache.Get(context.Background(), "a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, value)
+	assert.Nil(t, cache.Invalidate("a"))
+
+	cache.Get(context.Background(), "a")
+	assert.Equal(t, int32(3), loads.Load())
+	time.Sleep(60 * time.Millisecond) // negative entry过期
+	cache.Get(context.Background(), "a")
+	assert.Equal(t, int32(4), loads.Load())
+}
+
+func TestLoadingCache_backoff(t *testing.T) {
+	clock := newFakeClock()
+	var loads atomic.Int32
+	var fail atomic.Bool
+	fail.Store(true)
+	cache := caches.NewLoadingCache[int](100, func(ctx context.Context, key int) (any, error) {
+		n := loads.Add(1)
+		if fail.Load() {
+			return nil, fmt.Errorf("failure %d", n)
+		}
+		return key, nil
+	}, caches.LoadingConfig[int]{BackoffInitial: time.Second, BackoffMax: 4 * time.Second})
+	cache.Now = clock.Now
+
+	get := func() error {
+		_, err := cache.Get(context.Background(), 1)
+		return err
+	}
+	// 每次失败之后等待的时间：1s, 2s, 4s, 4s
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		n := loads.Load()
+		assert.EqualError(t, get(), fmt.Sprintf("failure %d", n+1))
+		clock.Advance(delay - time.Millisecond)
+		assert.EqualError(t, get(), fmt.Sprintf("failure %d", n+1)) // 返回上次的错误，不load
+		assert.Equal(t, n+1, loads.Load())
+		clock.Advance(time.Millisecond)
+	}
+
+	assert.Nil(t, cache.Invalidate(1)) // 重新开始计数
+	assert.EqualError(t, get(), "failure 5")
+	clock.Advance(time.Second)
+	fail.Store(false)
+	assert.Nil(t, get())
+	assert.Equal(t, int32(6), loads.Load())
+}
+
+func TestLoadingCache_refreshAfterWrite(t *testing.T) {
+	clock := newFakeClock()
+	var loads atomic.Int32
+	cache := caches.NewLoadingCache[string](100, func(ctx context.Context, key string) (any, error) {
+		return int(loads.Add(1)), nil
+	}, caches.LoadingConfig[string]{RefreshAfterWrite: time.Minute})
+	cache.Now = clock.Now
+
+	value, _ := cache.Get(context.Background(), "a")
+	assert.Equal(t, 1, value)
+	clock.Advance(time.Minute)
+	value, _ = cache.Get(context.Background(), "a") // 返回旧值，在后台刷新
+	assert.Equal(t, 1, value)
+	waitFor(t, func() bool {
+		value, _ := cache.GetIfPresent("a")
+		return value == 2
+	})
+}
+
+func TestLoadingCache_circuitBreaker(t *testing.T) {
+	clock := newFakeClock()
+	var loads atomic.Int32
+	var fail atomic.Bool
+	cache := caches.NewLoadingCache[string](100, func(ctx context.Context, key string) (any, error) {
+		loads.Add(1)
+		if fail.Load() {
+			return nil, errors.New("service down")
+		}
+		return key, nil
+	}, caches.LoadingConfig[string]{RefreshAfterWrite: time.Second, BreakerThreshold: 2, BreakerCooldown: time.Minute})
+	cache.Now = clock.Now
+
+	cache.Get(context.Background(), "stale")
+	fail.Store(true)
+	for _, key := range []string{"x", "y"} { // 连续失败两次，打开circuit breaker
+		_, err := cache.Get(context.Background(), key)
+		assert.EqualError(t, err, "service down")
+	}
+	_, err := cache.Get(context.Background(), "z")
+	assert.True(t, errors.Is(err, caches.ErrCircuitOpen))
+	assert.EqualError(t, err, "caches: circuit breaker is open: service down")
+
+	clock.Advance(2 * time.Second) // stale需要刷新，但是不调用loader
+	value, err := cache.Get(context.Background(), "stale")
+	assert.Nil(t, err)
+	assert.Equal(t, "stale", value)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(3), loads.Load())
+
+	clock.Advance(time.Minute)
+	fail.Store(false)
+	value, err = cache.Get(context.Background(), "z")
+	assert.Nil(t, err)
+	assert.Equal(t, "z", value)
+	assert.Equal(t, int32(4), loads.Load())
+}
+
+// waitFor waits for condition to hold, which happens in the background.
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("the condition did not hold")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
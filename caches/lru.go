@@ -8,6 +8,21 @@ const (
 	WindowPos Position = iota
 	ProbationPos
 	ProtectedPos
+	RecentPos        // ARC: T1, seen once recently
+	FrequentPos      // ARC: T2, seen at least twice recently
+	RecentGhostPos   // ARC: B1, evicted from T1, only the key is kept
+	FrequentGhostPos // ARC: B2, evicted from T2, only the key is kept
+	SmallPos         // S3-FIFO: small queue, new keys
+	MainPos          // S3-FIFO: main queue, keys accessed again while in the small queue
+	GhostPos         // S3-FIFO: ghost queue, evicted from the small queue, only the key is kept
+	LIRPos           // LIRS: low inter-reference recency, resident in stack S
+	HIRPos           // LIRS: high inter-reference recency, resident in queue Q and possibly in stack S
+	NonResidentPos   // LIRS: high inter-reference recency, only the key is kept in stack S
+	HotPos           // Clock-Pro: hot page
+	ColdPos          // Clock-Pro: resident cold page
+	TestPos          // Clock-Pro: non-resident cold page in its test period, only the key is kept
+
+	unlinkedPos Position = -1 // SizeCache: in the map, waiting in the write buffer of a ManagedCache to be admitted
 )
 
 // Element is an element of a linked lru.
@@ -16,6 +31,8 @@ type Element[K global.Key] struct {
 	Key        K
 	Value      any // The value stored with this element.
 	pos        Position
+	freq       uint8         // S3-FIFO的访问频率（最大为3），SIEVE的visited标记，Clock-Pro的reference标记
+	bucket     *lfuBucket[K] // LFUEvictionPolicy中元素所在的bucket
 }
 
 func WindowElement[K global.Key](key K, v any) *Element[K] {
@@ -42,6 +59,15 @@ func (e *Element[K]) IsInProbation() bool {
 func (e *Element[K]) IsInProtected() bool {
 	return e.pos == ProtectedPos
 }
+func (e *Element[K]) IsLIR() bool {
+	return e.pos == LIRPos
+}
+func (e *Element[K]) IsHIR() bool {
+	return e.pos == HIRPos || e.pos == NonResidentPos
+}
+func (e *Element[K]) IsResident() bool {
+	return e.pos != RecentGhostPos && e.pos != FrequentGhostPos && e.pos != GhostPos && e.pos != NonResidentPos && e.pos != TestPos
+}
 
 // LRU represents a doubly linked lru.
 // The zero value for LRU is an empty lru ready to use.
@@ -92,6 +118,14 @@ func (l *LRU[K]) Back() *Element[K] {
 	return l.root.prev
 }
 
+// Next returns the element after e, towards the back of lru l, or nil if e is the back.
+func (l *LRU[K]) Next(e *Element[K]) *Element[K] {
+	if e.next == &l.root {
+		return nil
+	}
+	return e.next
+}
+
 // insert inserts e after at, increments l.len, and returns e.
 func (l *LRU[K]) insert(e, at *Element[K]) *Element[K] {
 	e.prev = at
@@ -0,0 +1,41 @@
+package caches
+
+import "gaffeine/global"
+
+// LRUEvictionPolicy evicts the least recently used entry. With accessOrder off it ignores accesses,
+// and therefore evicts the entry inserted first (FIFO).
+type LRUEvictionPolicy[K global.Key] struct {
+	list        *LRU[K] // front is the most recently used entry, back is the victim
+	accessOrder bool
+}
+
+func NewLRUPolicy[K global.Key]() *LRUEvictionPolicy[K] {
+	return &LRUEvictionPolicy[K]{list: NewLRU[K](0, nil), accessOrder: true}
+}
+
+func NewFIFOPolicy[K global.Key]() *LRUEvictionPolicy[K] {
+	policy := NewLRUPolicy[K]()
+	policy.accessOrder = false
+	return policy
+}
+
+func (p *LRUEvictionPolicy[K]) OnAccess(ele *Element[K]) {
+	if p.accessOrder {
+		p.list.MoveToFront(ele)
+	}
+}
+
+func (p *LRUEvictionPolicy[K]) OnInsert(ele *Element[K]) {
+	p.list.InsertAtFront(ele)
+}
+
+func (p *LRUEvictionPolicy[K]) OnRemove(ele *Element[K]) {
+	p.list.Remove(ele)
+}
+
+func (p *LRUEvictionPolicy[K]) Victim() (*Element[K], bool) {
+	if back := p.list.Back(); back != nil {
+		return back, true
+	}
+	return nil, false
+}
@@ -0,0 +1,448 @@
+package caches
+
+import (
+	"container/list"
+	"gaffeine/frequncy_sketch"
+	"gaffeine/global"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ManagedCache is a SizeCache safe for concurrent use, with expiration, removal notifications and maintenance.
+//
+// The maintenance drains the buffers described below, expires the entries and passes the pending removal
+// notifications to the listener. It runs synchronously after the writes, when CleanUp is called, and in the goroutine
+// of the Scheduler if there is one, which also covers an idle cache. After Close, Get misses, Set is ignored and the methods returning an error return
+// ErrClosed, which Err reports for Get and Set.
+//
+// Get only takes a read lock, and records the hits in a ReadBuffer, which may drop some under contention. Set records
+// the new entries in a WriteBuffer. Both buffers are drained under the lock of the cache, applying the reads and then
+// the new entries to the policy, by the maintenance and when a buffer is full. With a scheduler, the new entries are
+// admitted, and the victims evicted, by its goroutine, so the cache may briefly exceed its size.
+//
+// With a CacheWriter, Set and Invalidate are also passed to a backing store, see ManagedConfig.Writer.
+type ManagedCache[K global.Key] struct {
+	mu               sync.RWMutex  // Get只需要读锁
+	cache            *SizeCache[K] // 值是*managedEntry
+	expireAfterWrite time.Duration // 0表示不过期
+	expiry           *list.List    // 按写入时间排序的*managedEntry，最早写入的在前面
+	reads            *ReadBuffer[Element[K]]
+	writes           *WriteBuffer[*Element[K]] // 新的entry，等待加入window
+	stats            Stats                     // Hits和Misses在hits和misses中
+	hits, misses     atomic.Uint64
+	pending          []RemovalNotification[K]
+
+	codec        Codec[any]
+	listener     RemovalListener[K]
+	heavyHitters int              // 跟踪的最热key的个数，LoadFrom恢复sketch之后重新开始跟踪
+	writing      *cacheWriting[K] // nil表示没有writer
+	dispatching  bool             // 有一个goroutine正在传递通知，保证通知按顺序传给listener和writer
+	scheduler    *Scheduler
+	closed       atomic.Bool
+
+	Now func() time.Time // 当前时间，测试时可以替换
+}
+
+type managedEntry[K global.Key] struct {
+	key       K
+	value     any
+	writtenAt time.Time
+	expiresAt time.Time
+	expiry    *list.Element
+}
+
+// ManagedConfig configures a ManagedCache. Zero values disable the features.
+type ManagedConfig[K global.Key] struct {
+	ExpireAfterWrite  time.Duration               // entries expire this long after they were set
+	RemovalListener   RemovalListener[K]          // notified of every removal
+	SchedulerInterval time.Duration               // the maintenance also runs in a background goroutine at this interval
+	HeavyHitters      int                         // the number of hottest keys tracked, see HeavyHitters
+	Sketch            *frequncy_sketch.Builder[K] // configures the sketch of W-TinyLFU, see SizeCache.ConfigureSketch
+	Codec             Codec[any]                  // encodes the values of the snapshots, GobCodec by default, see SaveTo
+
+	// Writer receives the writes of the cache. By default, it is write-through: Set and Invalidate call the writer
+	// first, and only change the cache if it succeeded. Set cannot return the error, which goes to OnWriteError.
+	// The automatic removals are passed to Writer.Delete after the fact, with their cause.
+	Writer CacheWriter[K]
+	// WriteBehindInterval enables write-behind: the cache changes at once, and the writes are coalesced per key and
+	// passed to the writer in write order by a background goroutine, by batches of at most WriteBehindBatch keys,
+	// 100 by default, every WriteBehindInterval or as soon as a batch is full. A failed write is retried by the next WriteRetries batches before being given up.
+	// The cache must be closed when done, which flushes the pending writes.
+	WriteBehindInterval time.Duration
+	WriteBehindBatch    int
+	WriteRetries        int
+	OnWriteError        WriteErrorHandler[K] // called with the writes given up
+}
+
+const writeBufferSize = 128 // buffer满了之后写入的goroutine会先drain
+
+// NewManagedCache returns a cache of the given size. If there is a scheduler, the cache must be closed when done.
+func NewManagedCache[K global.Key](size int, config ManagedConfig[K]) *ManagedCache[K] {
+	c := &ManagedCache[K]{
+		cache:            NewSizeCache[K](size),
+		expireAfterWrite: config.ExpireAfterWrite,
+		expiry:           list.New(),
+		reads:            NewReadBuffer[Element[K]](),
+		writes:           NewWriteBuffer[*Element[K]](writeBufferSize),
+		codec:            config.Codec,
+		listener:         config.RemovalListener,
+		heavyHitters:     config.HeavyHitters,
+		Now:              time.Now,
+	}
+	if c.codec == nil {
+		c.codec = GobCodec[any]{}
+	}
+	if config.Sketch != nil {
+		c.cache.ConfigureSketch(config.Sketch)
+	}
+	c.cache.Sketch.TrackHeavyHitters(config.HeavyHitters)
+	c.cache.OnEvict = func(key K, value any) {
+		entry := value.(*managedEntry[K])
+		c.unlinkExpiry(entry)
+		c.stats.Evictions++
+		c.notify(key, entry.value, RemovalSize)
+	}
+	if config.SchedulerInterval > 0 {
+		c.scheduler = NewScheduler(config.SchedulerInterval, c.maintain)
+	}
+	if config.Writer != nil {
+		c.writing = &cacheWriting[K]{writer: config.Writer, onError: config.OnWriteError}
+		if config.WriteBehindInterval > 0 {
+			batch := config.WriteBehindBatch
+			if batch <= 0 {
+				batch = 100
+			}
+			c.writing.behind = newWriteBehind(c.writing, config.WriteBehindInterval, batch, config.WriteRetries)
+		}
+	}
+	return c
+}
+
+// SizeCache returns the underlying cache, which must only be accessed while no other goroutine uses c.
+func (c *ManagedCache[K]) SizeCache() *SizeCache[K] {
+	return c.cache
+}
+
+func (c *ManagedCache[K]) Get(key K) (interface{}, bool) {
+	if c.closed.Load() {
+		return nil, false
+	}
+	value, _, ok := c.getEntry(key)
+	return value, ok
+}
+
+// getEntry returns the value of key and the time it was set. The read is recorded in the read buffer, and applied
+// to the policy by the next drain.
+func (c *ManagedCache[K]) getEntry(key K) (any, time.Time, bool) {
+	c.mu.RLock()
+	ele, ok := c.cache.DataMap[key]
+	var entry *managedEntry[K]
+	if ok {
+		entry = ele.Value.(*managedEntry[K])
+	}
+	c.mu.RUnlock()
+	if !ok {
+		c.misses.Add(1)
+		return nil, time.Time{}, false
+	}
+	if c.expired(entry) { // 过期的entry在读的时候也会被删除
+		c.misses.Add(1)
+		c.afterWrite(c.update(func() {
+			if ele, ok := c.cache.DataMap[key]; ok && c.expired(ele.Value.(*managedEntry[K])) {
+				c.removeLocked(key, RemovalExpired)
+			}
+		}))
+		return nil, time.Time{}, false
+	}
+	c.hits.Add(1)
+	if c.reads.Offer(ele) == BufferFull && c.mu.TryLock() { // 没有拿到锁的话，持有锁的写会drain
+		c.drainLocked()
+		pending := len(c.pending) > 0
+		c.mu.Unlock()
+		c.afterWrite(pending)
+	}
+	return entry.value, entry.writtenAt, true
+}
+
+func (c *ManagedCache[K]) Set(key K, value interface{}) {
+	if c.closed.Load() {
+		return
+	}
+	if c.writing == nil {
+		c.set(key, value)
+		return
+	}
+	var pending bool
+	err := c.writing.write(key, value, func() { pending = c.update(func() { c.setLocked(key, value) }) })
+	c.afterWrite(pending) // 在writer的锁之外，listener可以写同一个key
+	if err != nil {
+		c.writing.fail(key, err)
+	}
+}
+
+// set sets the value of key without passing it to the writer.
+func (c *ManagedCache[K]) set(key K, value any) {
+	c.afterWrite(c.update(func() { c.setLocked(key, value) }))
+}
+
+// setIf is set, unless cond returns false once the cache is locked.
+func (c *ManagedCache[K]) setIf(key K, value any, cond func() bool) {
+	c.afterWrite(c.update(func() {
+		if cond() {
+			c.setLocked(key, value)
+		}
+	}))
+}
+
+// update runs f under the lock of the cache, and reports whether it left notifications to dispatch or writes to
+// drain.
+func (c *ManagedCache[K]) update(f func()) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f()
+	return len(c.pending) > 0 || c.writes.Size() > 0
+}
+
+func (c *ManagedCache[K]) setLocked(key K, value any) {
+	entry := &managedEntry[K]{key: key, value: value, writtenAt: c.Now()}
+	if c.expireAfterWrite > 0 {
+		entry.expiresAt = entry.writtenAt.Add(c.expireAfterWrite)
+	}
+	if c.expireAfterWrite > 0 {
+		entry.expiry = c.expiry.PushBack(entry)
+	}
+	if ele, ok := c.cache.DataMap[key]; ok {
+		old := ele.Value.(*managedEntry[K])
+		c.unlinkExpiry(old)
+		cause := RemovalReplaced
+		if c.expired(old) {
+			cause = RemovalExpired
+		}
+		c.notify(key, old.value, cause)
+		ele.Value = entry
+		return
+	}
+	ele := c.cache.insert(key, entry)
+	for !c.writes.Offer(ele) { // 写不会丢失，buffer满了就先drain
+		c.drainLocked()
+	}
+	if c.scheduler == nil { // 否则由scheduler drain
+		c.drainLocked()
+	}
+}
+
+// Invalidate removes key from the cache. With a write-through writer, it returns the error of the writer, and then
+// keeps key.
+func (c *ManagedCache[K]) Invalidate(key K) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	if c.writing != nil {
+		var pending bool
+		err := c.writing.invalidate(key, func() { pending = c.update(func() { c.removeLocked(key, RemovalExplicit) }) })
+		c.afterWrite(pending)
+		return err
+	}
+	c.invalidate(key)
+	return nil
+}
+
+func (c *ManagedCache[K]) invalidate(key K) {
+	c.afterWrite(c.update(func() { c.removeLocked(key, RemovalExplicit) }))
+}
+
+// removeLocked removes key and notifies the listener with cause.
+func (c *ManagedCache[K]) removeLocked(key K, cause RemovalCause) bool {
+	value, ok := c.cache.Delete(key)
+	if !ok {
+		return false
+	}
+	entry := value.(*managedEntry[K])
+	c.unlinkExpiry(entry)
+	c.notify(key, entry.value, cause)
+	return true
+}
+
+// Len returns the number of entries in the cache, including expired entries not removed yet.
+func (c *ManagedCache[K]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache.Len()
+}
+
+// Stats returns the statistics of the cache.
+func (c *ManagedCache[K]) Stats() Stats {
+	c.mu.Lock()
+	stats := c.stats
+	c.mu.Unlock()
+	stats.Hits, stats.Misses = c.hits.Load(), c.misses.Load()
+	return stats
+}
+
+// HeavyHitters returns the hottest keys, see FrequencySketch.TrackHeavyHitters. The reads are counted once drained
+// by the maintenance.
+func (c *ManagedCache[K]) HeavyHitters() []frequncy_sketch.HeavyHitter[K] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cache.HeavyHitters()
+}
+
+// CleanUp runs the maintenance synchronously: it removes the expired entries, notifies the listener of
+// every pending removal and flushes the pending writes of write-behind.
+func (c *ManagedCache[K]) CleanUp() error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	c.maintain()
+	if c.writing != nil {
+		c.writing.flush()
+	}
+	return nil
+}
+
+// Err returns ErrClosed if the cache is closed, and nil otherwise.
+func (c *ManagedCache[K]) Err() error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close stops the scheduler, notifies the listener of the pending removals, flushes the pending writes and closes
+// the cache. Closing a closed cache returns ErrClosed.
+//
+// If the notifications are being delivered by another goroutine, or Close is called by the listener, Close does not
+// wait for them: the delivering goroutine also delivers the remaining ones.
+func (c *ManagedCache[K]) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	if c.scheduler != nil {
+		c.mu.Lock()
+		dispatching := c.dispatching
+		c.mu.Unlock()
+		if dispatching { // listener可能在scheduler的goroutine中调用Close，不能等待自己
+			c.scheduler.signalStop()
+		} else {
+			c.scheduler.Stop()
+		}
+	}
+	c.mu.Lock()
+	c.drainLocked()
+	c.mu.Unlock()
+	c.dispatch()
+	if c.writing != nil {
+		c.writing.close()
+	}
+	return nil
+}
+
+// maintain drains the buffers, expires the entries and dispatches the notifications.
+func (c *ManagedCache[K]) maintain() {
+	c.mu.Lock()
+	c.drainLocked()
+	c.expireLocked()
+	c.mu.Unlock()
+	c.dispatch()
+}
+
+// drainLocked applies the buffered reads and writes to the policy: the reads of the entries still cached, then the
+// admission of the new entries, which may evict others.
+func (c *ManagedCache[K]) drainLocked() {
+	c.reads.Drain(func(ele *Element[K]) {
+		if c.cache.DataMap[ele.Key] == ele {
+			c.cache.Get(ele.Key)
+		}
+	})
+	c.writes.Drain(c.cache.admit)
+}
+
+// expireLocked removes the expired entries, which are at the front of the expiry list.
+func (c *ManagedCache[K]) expireLocked() {
+	for front := c.expiry.Front(); front != nil; front = c.expiry.Front() {
+		entry := front.Value.(*managedEntry[K])
+		if !c.expired(entry) {
+			return
+		}
+		c.removeLocked(entry.key, RemovalExpired)
+	}
+}
+
+func (c *ManagedCache[K]) expired(entry *managedEntry[K]) bool {
+	return c.expireAfterWrite > 0 && !c.Now().Before(entry.expiresAt)
+}
+
+func (c *ManagedCache[K]) unlinkExpiry(entry *managedEntry[K]) {
+	if entry.expiry != nil {
+		c.expiry.Remove(entry.expiry)
+		entry.expiry = nil
+	}
+}
+
+func (c *ManagedCache[K]) notify(key K, value any, cause RemovalCause) {
+	if c.listener != nil || c.writing != nil {
+		c.pending = append(c.pending, RemovalNotification[K]{Key: key, Value: value, Cause: cause})
+	}
+}
+
+// afterWrite dispatches the pending notifications of a write, by the scheduler if there is one, otherwise by the
+// caller, which also covers a write racing with Close.
+func (c *ManagedCache[K]) afterWrite(pending bool) {
+	if !pending {
+		return
+	}
+	if c.scheduler != nil {
+		c.scheduler.Wake()
+		if !c.closed.Load() { // Close之后scheduler不再运行
+			return
+		}
+	}
+	c.dispatch()
+}
+
+// dispatch passes the pending notifications to the listener, and the automatic removals to the writer, outside
+// of the lock of the cache. A single goroutine delivers them at a time, in order: a dispatch while another is running,
+// including one from the listener itself, leaves the notifications to it, so that the listener can use the cache.
+func (c *ManagedCache[K]) dispatch() {
+	if c.listener == nil && c.writing == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.dispatching {
+		c.mu.Unlock()
+		return
+	}
+	c.dispatching = true
+	for len(c.pending) > 0 {
+		pending := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		c.deliver(pending)
+		c.mu.Lock()
+	}
+	c.dispatching = false
+	c.mu.Unlock()
+}
+
+// deliver passes notifications to the listener and the writer. If one of them panics, the remaining notifications
+// are dropped and the next dispatch can run.
+func (c *ManagedCache[K]) deliver(notifications []RemovalNotification[K]) {
+	delivered := false
+	defer func() {
+		if !delivered {
+			c.mu.Lock()
+			c.dispatching = false
+			c.mu.Unlock()
+		}
+	}()
+	for _, n := range notifications {
+		if c.writing != nil && n.Cause.WasEvicted() { // 其它原因已经在Set和Invalidate中写过了
+			c.writing.removed(n.Key, n.Cause)
+		}
+		if c.listener != nil {
+			c.listener(n.Key, n.Value, n.Cause)
+		}
+	}
+	delivered = true
+}
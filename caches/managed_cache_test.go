@@ -0,0 +1,341 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"gaffeine/frequncy_sketch"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock advanced by the tests, safe for concurrent use.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// removals records the notifications of a RemovalListener.
+type removals struct {
+	mu            sync.Mutex
+	notifications []caches.RemovalNotification[string]
+}
+
+func (r *removals) listener(key string, value any, cause caches.RemovalCause) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, caches.RemovalNotification[string]{Key: key, Value: value, Cause: cause})
+}
+
+func (r *removals) get() []caches.RemovalNotification[string] {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]caches.RemovalNotification[string](nil), r.notifications...)
+}
+
+func TestManagedCache_expireAfterWrite(t *testing.T) {
+	clock, removed := newFakeClock(), &removals{}
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		ExpireAfterWrite: time.Minute,
+		RemovalListener:  removed.listener,
+	})
+	cache.Now = clock.Now
+
+	cache.Set("a", 1)
+	clock.Advance(30 * time.Second)
+	cache.Set("b", 2)
+	v, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	clock.Advance(30 * time.Second) // a过期，b还没有过期
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	_, ok = cache.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, []caches.RemovalNotification[string]{{Key: "a", Value: 1, Cause: caches.RemovalExpired}}, removed.get())
+
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 1, cache.Len())
+	assert.Nil(t, cache.CleanUp()) // 没有访问也会被删除
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, caches.RemovalExpired, removed.get()[1].Cause)
+	assert.Equal(t, caches.Stats{Hits: 2, Misses: 1}, cache.Stats())
+}
+
+func TestManagedCache_removalCauses(t *testing.T) {
+	removed := &removals{}
+	cache := caches.NewManagedCache[string](4, caches.ManagedConfig[string]{RemovalListener: removed.listener})
+
+	cache.Set("a", 1)
+	cache.Set("a", 2)
+	assert.Nil(t, cache.Invalidate("a"))
+	assert.Nil(t, cache.Invalidate("a")) // 不存在的key没有通知
+	assert.Equal(t, []caches.RemovalNotification[string]{
+		{Key: "a", Value: 1, Cause: caches.RemovalReplaced},
+		{Key: "a", Value: 2, Cause: caches.RemovalExplicit},
+	}, removed.get())
+
+	for _, key := range []string{"b", "c", "d", "e", "f", "g", "h"} {
+		cache.Set(key, key)
+	}
+	evictions := 0
+	for _, n := range removed.get()[2:] {
+		assert.Equal(t, caches.RemovalSize, n.Cause)
+		assert.True(t, n.Cause.WasEvicted())
+		evictions++
+	}
+	assert.Equal(t, 7-cache.Len(), evictions)
+	assert.Equal(t, uint64(evictions), cache.Stats().Evictions)
+}
+
+func TestManagedCache_schedulerExpiresIdleCache(t *testing.T) {
+	clock := newFakeClock()
+	notified := make(chan string, 1)
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		ExpireAfterWrite:  time.Minute,
+		RemovalListener:   func(key string, value any, cause caches.RemovalCause) { notified <- key },
+		SchedulerInterval: time.Millisecond,
+	})
+	cache.Now = clock.Now
+	defer cache.Close()
+
+	cache.Set("a", 1)
+	clock.Advance(time.Minute) // 没有任何访问，由scheduler删除
+	select {
+	case key := <-notified:
+		assert.Equal(t, "a", key)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scheduler did not expire the idle cache")
+	}
+}
+
+func TestManagedCache_cleanUpDrainsBuffers(t *testing.T) {
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{HeavyHitters: 1})
+	cache.Set("a", 1) // 没有scheduler，写之后同步drain
+	for i := 0; i < 5; i++ {
+		cache.Get("a")
+	}
+	assert.Equal(t, []frequncy_sketch.HeavyHitter[string]{{Key: "a", Count: 1}}, cache.HeavyHitters())
+
+	assert.Nil(t, cache.CleanUp())
+	assert.Equal(t, []frequncy_sketch.HeavyHitter[string]{{Key: "a", Count: 6}}, cache.HeavyHitters())
+}
+
+func TestManagedCache_schedulerDrainsBuffers(t *testing.T) {
+	cache := caches.NewManagedCache[int](100, caches.ManagedConfig[int]{
+		HeavyHitters:      1,
+		SchedulerInterval: time.Millisecond,
+	})
+	defer cache.Close()
+	size := cache.SizeCache().MaximumSize
+	for i := 0; i < 2*size; i++ {
+		cache.Set(i, i)
+	}
+	waitFor(t, func() bool { return cache.Len() <= size }) // scheduler加入window并且淘汰
+	for i := 0; i < 5; i++ {
+		cache.Get(2*size - 1)
+	}
+	waitFor(t, func() bool {
+		hitters := cache.HeavyHitters()
+		return len(hitters) == 1 && hitters[0].Key == 2*size-1 && hitters[0].Count == 6
+	})
+}
+
+func TestManagedCache_close(t *testing.T) {
+	removed := &removals{}
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{
+		RemovalListener:   removed.listener,
+		SchedulerInterval: time.Hour,
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set("a", i)
+	}
+
+	assert.Nil(t, cache.Err())
+	assert.Nil(t, cache.Close())
+	assert.Equal(t, caches.ErrClosed, cache.Err()) // Get和Set不能返回error
+	// Close之前的通知都会传给listener，scheduler正在传递的时候由scheduler传递
+	waitFor(t, func() bool { return len(removed.get()) == 99 })
+
+	assert.Equal(t, caches.ErrClosed, cache.Close())
+	assert.Equal(t, caches.ErrClosed, cache.CleanUp())
+	assert.Equal(t, caches.ErrClosed, cache.Invalidate("a"))
+	cache.Set("b", 1)
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+}
+
+// waitGoroutines waits for the number of goroutines to drop to n, and returns the last count.
+func waitGoroutines(n int) int {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		count := runtime.NumGoroutine()
+		if count <= n || time.Now().After(deadline) {
+			return count
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManagedCache_noGoroutineLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	var all []*caches.ManagedCache[int]
+	for i := 0; i < 10; i++ {
+		all = append(all, caches.NewManagedCache[int](100, caches.ManagedConfig[int]{SchedulerInterval: time.Millisecond}))
+	}
+	assert.GreaterOrEqual(t, runtime.NumGoroutine(), before+10)
+
+	for _, cache := range all {
+		assert.Nil(t, cache.Close())
+	}
+	assert.Equal(t, before, waitGoroutines(before))
+}
+
+func TestManagedCache_concurrent(t *testing.T) {
+	var inListener, overlapped atomic.Int32
+	cache := caches.NewManagedCache[int](100, caches.ManagedConfig[int]{
+		ExpireAfterWrite: time.Millisecond,
+		RemovalListener: func(key int, value any, cause caches.RemovalCause) {
+			if inListener.Add(1) > 1 {
+				overlapped.Add(1)
+			}
+			inListener.Add(-1)
+		},
+		SchedulerInterval: time.Millisecond,
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := (i*31 + g) % 300
+				switch i % 4 {
+				case 0:
+					cache.Invalidate(key)
+				case 1:
+					cache.Set(key, i)
+				default:
+					cache.Get(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Nil(t, cache.Close())
+	assert.Equal(t, int32(0), overlapped.Load()) // listener不会被并发调用
+}
+
+func TestManagedCache_reentrantListener(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Millisecond} {
+		var cache *caches.ManagedCache[int]
+		var calls atomic.Int32
+		cache = caches.NewManagedCache[int](10, caches.ManagedConfig[int]{
+			RemovalListener: func(key int, value any, cause caches.RemovalCause) {
+				calls.Add(1)
+				cache.Get(key)
+				if cause == caches.RemovalSize && key < 100 {
+					cache.Set(key+100, value) // 又淘汰一个key，通知由同一个dispatch传递
+				}
+				cache.Invalidate(key + 100)
+			},
+			SchedulerInterval: interval,
+		})
+		for i := 0; i < 50; i++ {
+			cache.Set(i, i)
+		}
+		assert.Nil(t, cache.CleanUp())
+		waitFor(t, func() bool { return calls.Load() > 40 })
+		assert.Nil(t, cache.Close())
+	}
+}
+
+func TestManagedCache_reentrantListenerWithWriter(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Millisecond} {
+		var cache *caches.ManagedCache[string]
+		invalidated := make(chan string, 1)
+		cache = caches.NewManagedCache[string](10, caches.ManagedConfig[string]{
+			RemovalListener: func(key string, value any, cause caches.RemovalCause) {
+				if cause == caches.RemovalReplaced {
+					cache.Invalidate(key) // 同一个key的writer锁已经释放了
+					invalidated <- key
+				}
+			},
+			SchedulerInterval: interval,
+			Writer:            newStore(),
+		})
+		go func() {
+			cache.Set("a", 1)
+			cache.Set("a", 2)
+		}()
+		select {
+		case key := <-invalidated:
+			assert.Equal(t, "a", key)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the listener is blocked")
+		}
+		assert.Nil(t, cache.Close())
+	}
+}
+
+func TestManagedCache_listenerCloses(t *testing.T) {
+	closed := make(chan error, 1)
+	var cache *caches.ManagedCache[int]
+	cache = caches.NewManagedCache[int](100, caches.ManagedConfig[int]{
+		RemovalListener: func(key int, value any, cause caches.RemovalCause) {
+			select {
+			case closed <- cache.Close(): // 在scheduler的goroutine中
+			default:
+			}
+		},
+		SchedulerInterval: time.Hour,
+	})
+	cache.Set(1, 1)
+	cache.Set(1, 2)
+	select {
+	case err := <-closed:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close called by the listener did not return")
+	}
+	assert.Equal(t, caches.ErrClosed, cache.Close())
+}
+
+func TestScheduler(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	s := caches.NewScheduler(time.Hour, func() {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	})
+	s.Wake()
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wake did not run the task")
+	}
+	s.Stop()
+	s.Stop()
+}
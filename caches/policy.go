@@ -0,0 +1,145 @@
+package caches
+
+import (
+	"fmt"
+	"gaffeine/global"
+)
+
+// EvictionPolicy decides which entry to evict from a PolicyCache when it is full.
+// The cache stores the entries as Elements, like SizeCache, and the policy orders these same elements in its own
+// LRU lists, so an entry is stored once. An element belongs to a single policy.
+type EvictionPolicy[K global.Key] interface {
+	OnAccess(ele *Element[K])    // the entry is read, or its value is replaced
+	OnInsert(ele *Element[K])    // the entry is added to the cache
+	OnRemove(ele *Element[K])    // the entry is removed from the cache, either evicted or deleted
+	Victim() (*Element[K], bool) // the entry to evict next, false if the policy has no entry
+}
+
+// PolicyKind selects the eviction policy of the cache built by NewCache and the Gaffeine builder.
+type PolicyKind int
+
+const (
+	TinyLFUPolicy  PolicyKind = iota // W-TinyLFU, see SizeCache
+	LRUPolicy                        // least recently used
+	LFUPolicy                        // least frequently used
+	FIFOPolicy                       // first in, first out
+	ARCPolicy                        // adaptive replacement cache, see ARCCache
+	S3FIFOPolicy                     // simple, scalable caching with three static FIFO queues, see S3FIFOCache
+	SIEVEPolicy                      // FIFO with a visited bit and a moving hand, see SIEVEEvictionPolicy
+	LIRSPolicy                       // low inter-reference recency set, see LIRSCache
+	ClockProPolicy                   // CLOCK with adaptive hot and cold pages, see ClockProCache
+)
+
+var policyNames = map[PolicyKind]string{
+	TinyLFUPolicy:  "tinylfu",
+	LRUPolicy:      "lru",
+	LFUPolicy:      "lfu",
+	FIFOPolicy:     "fifo",
+	ARCPolicy:      "arc",
+	S3FIFOPolicy:   "s3fifo",
+	SIEVEPolicy:    "sieve",
+	LIRSPolicy:     "lirs",
+	ClockProPolicy: "clockpro",
+}
+
+func (k PolicyKind) String() string {
+	if name, ok := policyNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("PolicyKind(%d)", int(k))
+}
+
+// ParsePolicyKind returns the PolicyKind of the given name, e.g. "lru".
+func ParsePolicyKind(name string) (PolicyKind, error) {
+	for kind, n := range policyNames {
+		if n == name {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("caches: unknown policy %q", name)
+}
+
+// NewCache returns a cache of the given size evicting with the given policy.
+func NewCache[K global.Key](kind PolicyKind, size int) Cache[K] {
+	switch kind {
+	case TinyLFUPolicy:
+		return NewSizeCache[K](size)
+	case LRUPolicy:
+		return NewPolicyCache[K](size, NewLRUPolicy[K]())
+	case LFUPolicy:
+		return NewPolicyCache[K](size, NewLFUPolicy[K]())
+	case FIFOPolicy:
+		return NewPolicyCache[K](size, NewFIFOPolicy[K]())
+	case ARCPolicy:
+		return NewARCCache[K](size)
+	case S3FIFOPolicy:
+		return NewS3FIFOCache[K](size)
+	case SIEVEPolicy:
+		return NewPolicyCache[K](size, NewSIEVEPolicy[K]())
+	case LIRSPolicy:
+		return NewLIRSCache[K](size)
+	case ClockProPolicy:
+		return NewClockProCache[K](size)
+	default:
+		panic(fmt.Sprintf("not support this policy: %v", kind))
+	}
+}
+
+// PolicyCache stores at most MaximumSize entries and delegates the choice of the victims to an EvictionPolicy.
+type PolicyCache[K global.Key] struct {
+	MaximumSize int
+	DataMap     map[K]*Element[K]
+	Policy      EvictionPolicy[K]
+}
+
+func NewPolicyCache[K global.Key](size int, policy EvictionPolicy[K]) *PolicyCache[K] {
+	if size <= 0 {
+		size = 1
+	}
+	return &PolicyCache[K]{
+		MaximumSize: size,
+		DataMap:     make(map[K]*Element[K], size),
+		Policy:      policy,
+	}
+}
+
+func (c *PolicyCache[K]) Get(key K) (interface{}, bool) {
+	if ele, ok := c.DataMap[key]; ok {
+		c.Policy.OnAccess(ele)
+		return ele.Value, true
+	}
+	return nil, false
+}
+
+// Set sets key and value to cache, evicting the policy's victim first if the cache is full.
+func (c *PolicyCache[K]) Set(key K, value interface{}) {
+	if ele, ok := c.DataMap[key]; ok { // 表示key已经存在，更新value
+		ele.Value = value
+		c.Policy.OnAccess(ele)
+		return
+	}
+
+	for len(c.DataMap) >= c.MaximumSize {
+		victim, ok := c.Policy.Victim()
+		if !ok {
+			break
+		}
+		c.Delete(victim.Key)
+	}
+	ele := &Element[K]{Key: key, Value: value}
+	c.DataMap[key] = ele
+	c.Policy.OnInsert(ele)
+}
+
+// Delete removes key from the cache.
+func (c *PolicyCache[K]) Delete(key K) {
+	if ele, ok := c.DataMap[key]; ok {
+		delete(c.DataMap, key)
+		c.Policy.OnRemove(ele)
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (c *PolicyCache[K]) Len() int {
+	return len(c.DataMap)
+}
@@ -0,0 +1,125 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicyKind(t *testing.T) {
+	for _, kind := range []caches.PolicyKind{caches.TinyLFUPolicy, caches.LRUPolicy, caches.LFUPolicy, caches.FIFOPolicy, caches.ARCPolicy, caches.S3FIFOPolicy, caches.SIEVEPolicy, caches.LIRSPolicy, caches.ClockProPolicy} {
+		parsed, err := caches.ParsePolicyKind(kind.String())
+		assert.Nil(t, err)
+		assert.Equal(t, kind, parsed)
+	}
+	_, err := caches.ParsePolicyKind("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestPolicyCache_setAndGet(t *testing.T) {
+	cache := caches.NewPolicyCache[string](2, caches.NewLRUPolicy[string]())
+	cache.Set("key", 10)
+	cache.Set("key", 20)
+	v, ok := cache.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, 20, v.(int))
+	assert.Equal(t, 1, cache.Len())
+
+	cache.Delete("key")
+	_, ok = cache.Get("key")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestLRUPolicy(t *testing.T) {
+	cache := caches.NewPolicyCache[string](2, caches.NewLRUPolicy[string]())
+	cache.Set("k1", 1)
+	cache.Set("k2", 2)
+	cache.Get("k1")    // k1 比 k2 新
+	cache.Set("k3", 3) // 淘汰 k2
+
+	_, ok := cache.Get("k2")
+	assert.False(t, ok)
+	_, ok = cache.Get("k1")
+	assert.True(t, ok)
+	_, ok = cache.Get("k3")
+	assert.True(t, ok)
+}
+
+func TestPolicyCache_sharesElements(t *testing.T) {
+	cache := caches.NewPolicyCache[string](2, caches.NewLRUPolicy[string]())
+	cache.Set("k1", 1)
+	ele := cache.DataMap["k1"]
+	cache.Set("k1", 2) // 更新value，不创建新的元素
+	assert.Same(t, ele, cache.DataMap["k1"])
+	assert.Equal(t, 2, ele.Value)
+}
+
+func TestFIFOPolicy(t *testing.T) {
+	cache := caches.NewPolicyCache[string](2, caches.NewFIFOPolicy[string]())
+	cache.Set("k1", 1)
+	cache.Set("k2", 2)
+	cache.Get("k1")    // FIFO 忽略访问
+	cache.Set("k3", 3) // 淘汰最先插入的 k1
+
+	_, ok := cache.Get("k1")
+	assert.False(t, ok)
+	_, ok = cache.Get("k2")
+	assert.True(t, ok)
+}
+
+func TestLFUPolicy(t *testing.T) {
+	policy := caches.NewLFUPolicy[string]()
+	cache := caches.NewPolicyCache[string](3, policy)
+	cache.Set("k1", 1)
+	cache.Set("k2", 2)
+	cache.Set("k3", 3)
+	cache.Get("k1")
+	cache.Get("k1")
+	cache.Get("k2")
+	k1, k2, k3 := cache.DataMap["k1"], cache.DataMap["k2"], cache.DataMap["k3"]
+	assert.Equal(t, 3, policy.Frequency(k1))
+	assert.Equal(t, 2, policy.Frequency(k2))
+	assert.Equal(t, 1, policy.Frequency(k3))
+
+	cache.Set("k4", 4) // 淘汰频率最低的 k3
+	_, ok := cache.Get("k3")
+	assert.False(t, ok)
+	assert.Equal(t, 0, policy.Frequency(k3))
+
+	cache.Set("k5", 5) // k4 的频率最低
+	_, ok = cache.Get("k4")
+	assert.False(t, ok)
+
+	cache.Get("k5")
+	cache.Get("k5")
+	cache.Get("k5")
+	cache.Set("k6", 6) // k1是3，k5是4，淘汰频率最低的 k2
+	assert.Equal(t, 0, policy.Frequency(k2))
+	assert.Equal(t, 3, policy.Frequency(k1))
+	assert.Equal(t, 4, policy.Frequency(cache.DataMap["k5"]))
+	assert.Equal(t, 3, cache.Len())
+}
+
+func TestLFUPolicy_victim(t *testing.T) {
+	policy := caches.NewLFUPolicy[int]()
+	_, ok := policy.Victim()
+	assert.False(t, ok)
+
+	e1, e2 := &caches.Element[int]{Key: 1}, &caches.Element[int]{Key: 2}
+	policy.OnInsert(e1)
+	policy.OnInsert(e2)
+	policy.OnAccess(e1)
+	victim, ok := policy.Victim()
+	assert.True(t, ok)
+	assert.Equal(t, e2, victim)
+
+	policy.OnAccess(e2) // 频率相同时，淘汰最久未使用的 1
+	victim, _ = policy.Victim()
+	assert.Equal(t, e1, victim)
+
+	policy.OnRemove(e2)
+	policy.OnRemove(e1)
+	_, ok = policy.Victim()
+	assert.False(t, ok)
+}
@@ -0,0 +1,135 @@
+package caches
+
+import (
+	"gaffeine/utils"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// BufferResult is the result of ReadBuffer.Offer.
+type BufferResult int
+
+const (
+	BufferSuccess BufferResult = iota // the element was added
+	BufferFailed                      // the element was dropped because of contention
+	BufferFull                        // the element was dropped because the buffer is full, it should be drained
+)
+
+const readRingSize = 16 // 每个stripe的容量
+
+// ReadBuffer is a lossy buffer of the reads waiting to be applied to the policy, like the read buffer of Caffeine.
+// The reads are spread over stripes of small ring buffers, and the number of stripes doubles, up to four times
+// GOMAXPROCS, whenever producers contend on a stripe. Losing a read only makes the policy slightly less accurate,
+// so Offer drops the element rather than waiting.
+type ReadBuffer[T any] struct {
+	stripes    atomic.Pointer[[]*readRing[T]]
+	maxStripes int
+	expanding  atomic.Bool
+	probes     sync.Pool // 每个P缓存一个probe，相当于Caffeine中每个线程的probe
+}
+
+type readRing[T any] struct {
+	head  atomic.Uint64 // 只有消费者修改
+	_     [56]byte
+	tail  atomic.Uint64
+	_     [56]byte
+	slots [readRingSize]atomic.Pointer[T]
+}
+
+type probe struct {
+	x uint32
+}
+
+// NewReadBuffer returns a buffer with a single stripe.
+func NewReadBuffer[T any]() *ReadBuffer[T] {
+	b := &ReadBuffer[T]{maxStripes: 4 * utils.CeilingPowerOfTwo32(runtime.GOMAXPROCS(0))}
+	stripes := []*readRing[T]{new(readRing[T])}
+	b.stripes.Store(&stripes)
+	seed := uint32(0x9e3779b9)
+	var mu sync.Mutex
+	b.probes.New = func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		seed += 0x9e3779b9
+		return &probe{x: seed}
+	}
+	return b
+}
+
+// Offer adds e, which must not be nil, to the buffer. It is safe for concurrent use.
+func (b *ReadBuffer[T]) Offer(e *T) BufferResult {
+	p := b.probes.Get().(*probe)
+	stripes := *b.stripes.Load()
+	result := stripes[p.x&uint32(len(stripes)-1)].offer(e)
+	if result == BufferFailed {
+		b.expand(len(stripes))
+		p.x ^= p.x << 13 // xorshift，换一个stripe
+		p.x ^= p.x >> 17
+		p.x ^= p.x << 5
+	}
+	b.probes.Put(p)
+	return result
+}
+
+// expand doubles the stripes, unless another producer already did or the maximum is reached.
+func (b *ReadBuffer[T]) expand(length int) {
+	if length >= b.maxStripes || !b.expanding.CompareAndSwap(false, true) {
+		return
+	}
+	defer b.expanding.Store(false)
+	stripes := *b.stripes.Load()
+	if len(stripes) != length {
+		return
+	}
+	expanded := make([]*readRing[T], 2*length)
+	copy(expanded, stripes)
+	for i := length; i < len(expanded); i++ {
+		expanded[i] = new(readRing[T])
+	}
+	b.stripes.Store(&expanded)
+}
+
+// Drain removes every element and passes it to consume, and returns the number of elements.
+// It must only be called by a single consumer at a time.
+func (b *ReadBuffer[T]) Drain(consume func(*T)) int {
+	n := 0
+	for _, ring := range *b.stripes.Load() {
+		n += ring.drain(consume)
+	}
+	return n
+}
+
+// Stripes returns the current number of stripes.
+func (b *ReadBuffer[T]) Stripes() int {
+	return len(*b.stripes.Load())
+}
+
+func (r *readRing[T]) offer(e *T) BufferResult {
+	head, tail := r.head.Load(), r.tail.Load()
+	if tail-head >= readRingSize {
+		return BufferFull
+	}
+	if !r.tail.CompareAndSwap(tail, tail+1) {
+		return BufferFailed
+	}
+	r.slots[tail&(readRingSize-1)].Store(e)
+	return BufferSuccess
+}
+
+func (r *readRing[T]) drain(consume func(*T)) int {
+	head, tail := r.head.Load(), r.tail.Load()
+	n := 0
+	for ; head != tail; head++ {
+		slot := &r.slots[head&(readRingSize-1)]
+		e := slot.Load()
+		if e == nil { // 生产者抢占了位置但还没有写入，下次再读
+			break
+		}
+		slot.Store(nil)
+		consume(e)
+		n++
+	}
+	r.head.Store(head)
+	return n
+}
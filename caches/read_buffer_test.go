@@ -0,0 +1,85 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadBuffer(t *testing.T) {
+	b := caches.NewReadBuffer[int]()
+	assert.Equal(t, 1, b.Stripes())
+
+	values := make([]int, 20)
+	for i := range values {
+		values[i] = i
+	}
+	for i := 0; i < 16; i++ {
+		assert.Equal(t, caches.BufferSuccess, b.Offer(&values[i]))
+	}
+	assert.Equal(t, caches.BufferFull, b.Offer(&values[16])) // 满了就丢弃
+
+	var drained []int
+	assert.Equal(t, 16, b.Drain(func(e *int) { drained = append(drained, *e) }))
+	assert.Equal(t, values[:16], drained)
+	assert.Equal(t, 0, b.Drain(func(*int) {}))
+	assert.Equal(t, caches.BufferSuccess, b.Offer(&values[17]))
+}
+
+func TestReadBuffer_concurrent(t *testing.T) {
+	b := caches.NewReadBuffer[int]()
+	var offered, drained atomic.Int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	consumerDone := make(chan struct{})
+	go func() { // 消费者和生产者同时运行
+		defer close(consumerDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				drained.Add(int64(b.Drain(func(*int) {})))
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	value := 1
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10_000; i++ {
+				if b.Offer(&value) == caches.BufferSuccess {
+					offered.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-consumerDone
+	drained.Add(int64(b.Drain(func(*int) {})))
+
+	assert.Equal(t, offered.Load(), drained.Load()) // 成功加入的元素都被消费了
+	assert.LessOrEqual(t, b.Stripes(), 4*runtime.GOMAXPROCS(0)*2)
+}
+
+func BenchmarkReadBuffer_Offer(b *testing.B) {
+	buffer := caches.NewReadBuffer[int]()
+	var mu sync.Mutex
+	value := 1
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if buffer.Offer(&value) == caches.BufferFull && mu.TryLock() {
+				buffer.Drain(func(*int) {})
+				mu.Unlock()
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package caches
+
+import (
+	"gaffeine/frequncy_sketch"
+	"gaffeine/global"
+	"gaffeine/trace"
+	"strconv"
+)
+
+// RecordingCache records the key of every Get and Set to Recorder before delegating to Cache, so that the traffic of a
+// live cache can be replayed offline by the simulator, which replays the Sets as writes rather than requests.
+type RecordingCache[K global.Key] struct {
+	Cache    Cache[K]
+	Recorder *trace.Recorder
+}
+
+func NewRecordingCache[K global.Key](cache Cache[K], recorder *trace.Recorder) *RecordingCache[K] {
+	return &RecordingCache[K]{Cache: cache, Recorder: recorder}
+}
+
+func (c *RecordingCache[K]) Get(key K) (interface{}, bool) {
+	c.Recorder.Record(formatKey(key))
+	return c.Cache.Get(key)
+}
+
+func (c *RecordingCache[K]) Set(key K, value interface{}) {
+	c.Recorder.RecordSet(formatKey(key))
+	c.Cache.Set(key, value)
+}
+
+// HeavyHitters returns the heavy hitters of the recorded cache, or nil if it is not an Inspector.
+func (c *RecordingCache[K]) HeavyHitters() []frequncy_sketch.HeavyHitter[K] {
+	if inspector, ok := c.Cache.(Inspector[K]); ok {
+		return inspector.HeavyHitters()
+	}
+	return nil
+}
+
+// CleanUp runs the maintenance of the recorded cache, if it is a Maintainer.
+func (c *RecordingCache[K]) CleanUp() error {
+	if maintainer, ok := c.Cache.(Maintainer); ok {
+		return maintainer.CleanUp()
+	}
+	return nil
+}
+
+// Close closes the recorded cache, if it is a Maintainer. The recorder is owned by the caller and stays open.
+func (c *RecordingCache[K]) Close() error {
+	if maintainer, ok := c.Cache.(Maintainer); ok {
+		return maintainer.Close()
+	}
+	return nil
+}
+
+// Err returns the error of the recorded cache, if it is a Maintainer.
+func (c *RecordingCache[K]) Err() error {
+	if maintainer, ok := c.Cache.(Maintainer); ok {
+		return maintainer.Err()
+	}
+	return nil
+}
+
+// formatKey 把key格式化成trace中的字符串，不使用fmt以减少开销
+func formatKey[K global.Key](key K) string {
+	switch k := any(key).(type) {
+	case string:
+		return k
+	case int:
+		return strconv.FormatInt(int64(k), 10)
+	case int8:
+		return strconv.FormatInt(int64(k), 10)
+	case int16:
+		return strconv.FormatInt(int64(k), 10)
+	case int32:
+		return strconv.FormatInt(int64(k), 10)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case uint:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint64:
+		return strconv.FormatUint(k, 10)
+	case float32:
+		return strconv.FormatFloat(float64(k), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(k, 'g', -1, 64)
+	default:
+		panic("not support this type")
+	}
+}
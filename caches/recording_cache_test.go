@@ -0,0 +1,46 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"gaffeine/simulator"
+	"gaffeine/trace"
+	"gaffeine/workload"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordingCache_replayedHitRatio(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.gz")
+	recorder, err := trace.NewRecorder(path, trace.RecorderConfig{BufferSize: 1 << 16})
+	assert.Nil(t, err)
+	cache := caches.NewRecordingCache[string](caches.NewCache[string](caches.LRUPolicy, 100), recorder)
+
+	// 和simulator一样：读key，不命中时写入
+	requests, hits := 0, 0
+	r := workload.Trace(workload.NewZipf(1, 1000, 0.9), 20_000)
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		requests++
+		if _, ok := cache.Get(event.Key); ok {
+			hits++
+		} else {
+			cache.Set(event.Key, event.Size)
+		}
+	}
+	assert.Nil(t, cache.Close())
+	assert.Nil(t, recorder.Close())
+	assert.Equal(t, uint64(0), recorder.Dropped())
+
+	replay, err := trace.Open(path, trace.RecordFormat)
+	assert.Nil(t, err)
+	defer replay.Close()
+	results, err := simulator.Simulate(replay, []caches.PolicyKind{caches.LRUPolicy}, []int{100})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(requests), results[0].Requests)
+	assert.Equal(t, int64(hits), results[0].Hits)
+}
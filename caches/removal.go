@@ -0,0 +1,49 @@
+package caches
+
+import (
+	"errors"
+	"fmt"
+	"gaffeine/global"
+)
+
+// ErrClosed is returned by the operations of a closed cache.
+var ErrClosed = errors.New("caches: cache is closed")
+
+// RemovalCause is the reason why an entry was removed.
+type RemovalCause int
+
+const (
+	RemovalExplicit RemovalCause = iota // the entry was invalidated by the user
+	RemovalReplaced                     // the value was replaced by Set
+	RemovalExpired                      // the entry expired
+	RemovalSize                         // the entry was evicted to bound the size of the cache
+)
+
+var removalCauseNames = map[RemovalCause]string{
+	RemovalExplicit: "explicit",
+	RemovalReplaced: "replaced",
+	RemovalExpired:  "expired",
+	RemovalSize:     "size",
+}
+
+func (c RemovalCause) String() string {
+	if name, ok := removalCauseNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("RemovalCause(%d)", int(c))
+}
+
+// WasEvicted reports whether the entry was removed automatically, rather than by the user.
+func (c RemovalCause) WasEvicted() bool {
+	return c == RemovalExpired || c == RemovalSize
+}
+
+// RemovalListener is notified of the removal of every entry, outside of the locks of the cache.
+type RemovalListener[K global.Key] func(key K, value any, cause RemovalCause)
+
+// RemovalNotification is a removal waiting to be passed to the RemovalListener.
+type RemovalNotification[K global.Key] struct {
+	Key   K
+	Value any
+	Cause RemovalCause
+}
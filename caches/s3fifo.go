@@ -0,0 +1,143 @@
+package caches
+
+import (
+	"gaffeine/global"
+	"gaffeine/utils"
+)
+
+const s3fifoMaxFreq = 3
+
+// S3FIFOCache is a cache evicting with S3-FIFO [1].
+// New keys enter the small FIFO queue, which holds 10% of the entries. A key evicted from the small queue
+// moves to the main FIFO queue if it was accessed again, otherwise only its key is remembered in the ghost queue,
+// and a key found in the ghost queue is inserted directly into the main queue.
+// The main queue is a FIFO with reinsertion: a key at its tail that was accessed is moved back to the head.
+// Most one-hit wonders are thus evicted quickly from the small queue, and a hit only updates a counter.
+//
+// [1] FIFO queues are all you need for cache eviction
+// https://dl.acm.org/doi/10.1145/3600006.3613147
+type S3FIFOCache[K global.Key] struct {
+	MaximumSize int
+	DataMap     map[K]*Element[K] // 包含 Small、Main、Ghost 中所有的key，Element 的 pos 表示所在的队列
+	Small       *LRU[K]           // front是队头（最新的元素），back是队尾
+	Main        *LRU[K]
+	Ghost       *LRU[K]
+}
+
+func NewS3FIFOCache[K global.Key](size int) *S3FIFOCache[K] {
+	if size <= 0 {
+		size = 1
+	}
+	smallSize := size / 10
+	if smallSize <= 0 {
+		smallSize = 1
+	}
+	mainSize := size - smallSize
+	dataMap := make(map[K]*Element[K])
+	return &S3FIFOCache[K]{
+		MaximumSize: size,
+		DataMap:     dataMap,
+		Small:       NewLRU(smallSize, dataMap),
+		Main:        NewLRU(mainSize, dataMap),
+		Ghost:       NewLRU(int(utils.Max(mainSize, 1)), dataMap),
+	}
+}
+
+func (c *S3FIFOCache[K]) Get(key K) (interface{}, bool) {
+	ele, ok := c.DataMap[key]
+	if !ok || ele.pos == GhostPos {
+		return nil, false
+	}
+	if ele.freq < s3fifoMaxFreq {
+		ele.freq++
+	}
+	return ele.Value, true
+}
+
+// Set sets key and value to cache.
+// step:
+// 如果key已经存在，更新value，增加访问频率
+// 如果key在Ghost中，淘汰后插入到Main的队头
+// 否则，淘汰后插入到Small的队头
+func (c *S3FIFOCache[K]) Set(key K, value interface{}) {
+	ele, ok := c.DataMap[key]
+	if ok && ele.pos != GhostPos { // 表示key已经存在，更新value
+		ele.Value = value
+		if ele.freq < s3fifoMaxFreq {
+			ele.freq++
+		}
+		return
+	}
+
+	if ok { // Ghost命中，说明这个key被过早地淘汰了，直接放到Main
+		c.Ghost.Remove(ele)
+	}
+	for c.Len() >= c.MaximumSize {
+		c.evict()
+	}
+	if ok {
+		ele.Value, ele.freq, ele.pos = value, 0, MainPos
+		c.Main.InsertAtFront(ele)
+		return
+	}
+	ele = c.Small.PushFront(value)
+	ele.Key = key
+	ele.pos = SmallPos
+	c.DataMap[key] = ele
+}
+
+// Len returns the number of entries in the cache, ghost keys excluded.
+func (c *S3FIFOCache[K]) Len() int {
+	return c.Small.Len() + c.Main.Len()
+}
+
+func (c *S3FIFOCache[K]) evict() {
+	if c.Small.Len() >= c.Small.Size() || c.Main.Len() == 0 {
+		c.evictSmall()
+	} else {
+		c.evictMain()
+	}
+}
+
+// evictSmall evicts the tail of the small queue, moving the tail to the main queue instead if it was accessed again,
+// where its frequency starts over from zero.
+func (c *S3FIFOCache[K]) evictSmall() {
+	for c.Small.Len() > 0 {
+		tail := c.Small.Back()
+		c.Small.Remove(tail)
+		if tail.freq > 0 {
+			tail.freq, tail.pos = 0, MainPos // Main中只计算移动之后的访问
+			c.Main.InsertAtFront(tail)
+			if c.Main.Len() > c.Main.Size() {
+				c.evictMain()
+				return
+			}
+			continue
+		}
+
+		tail.Value, tail.pos = nil, GhostPos // ghost只保留key
+		c.Ghost.InsertAtFront(tail)
+		if c.Ghost.Len() > c.Ghost.Size() {
+			back := c.Ghost.Back()
+			c.Ghost.Remove(back)
+			delete(c.DataMap, back.Key)
+		}
+		return
+	}
+}
+
+// evictMain evicts the first key without access found from the tail of the main queue,
+// reinserting the accessed ones at the head with a decremented frequency.
+func (c *S3FIFOCache[K]) evictMain() {
+	for c.Main.Len() > 0 {
+		tail := c.Main.Back()
+		if tail.freq > 0 {
+			tail.freq--
+			c.Main.MoveToFront(tail)
+			continue
+		}
+		c.Main.Remove(tail)
+		delete(c.DataMap, tail.Key)
+		return
+	}
+}
@@ -0,0 +1,118 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestS3FIFO_construct(t *testing.T) {
+	cache := caches.NewS3FIFOCache[string](100)
+	assert.Equal(t, 10, cache.Small.Size())
+	assert.Equal(t, 90, cache.Main.Size())
+	assert.Equal(t, 90, cache.Ghost.Size())
+
+	cache = caches.NewS3FIFOCache[string](4)
+	assert.Equal(t, 1, cache.Small.Size())
+	assert.Equal(t, 3, cache.Main.Size())
+}
+
+func TestS3FIFO_setAndGet(t *testing.T) {
+	cache := caches.NewS3FIFOCache[string](10)
+	cache.Set("key", 10)
+	cache.Set("key", 20)
+	v, ok := cache.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, 20, v.(int))
+	assert.Equal(t, 1, cache.Small.Len())
+}
+
+func TestS3FIFO_oneHitWonderGoesToGhost(t *testing.T) {
+	cache := caches.NewS3FIFOCache[int](10)
+	cache.Set(1, 1)
+	cache.Get(1) // 在Small中被再次访问，淘汰时移动到Main
+	for i := 2; i <= 10; i++ {
+		cache.Set(i, i)
+	}
+	cache.Set(11, 11) // Small满了：1 移动到Main，2 淘汰到Ghost
+
+	_, ok := cache.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, 1, cache.Main.Len())
+	_, ok = cache.Get(2)
+	assert.False(t, ok)
+	assert.Equal(t, 10, cache.Len())
+
+	// Ghost命中，直接插入到Main
+	cache.Set(2, 20)
+	assert.Equal(t, 2, cache.Main.Len())
+	v, ok := cache.Get(2)
+	assert.True(t, ok)
+	assert.Equal(t, 20, v.(int))
+	assert.Equal(t, 10, cache.Len())
+}
+
+func TestS3FIFO_promotionResetsFrequency(t *testing.T) {
+	cache := caches.NewS3FIFOCache[int](4) // Small 1，Main 3
+	cache.Set(1, 1)
+	for i := 0; i < 3; i++ { // 在Small中的访问只决定是否移动到Main
+		cache.Get(1)
+	}
+	for i := 2; i <= 5; i++ {
+		cache.Set(i, i) // 5：1 移动到Main
+	}
+	cache.Get(3)
+	cache.Set(6, 6) // 3 移动到Main
+	cache.Get(3)    // 在Main中被访问
+	cache.Get(5)
+	cache.Get(6)
+	cache.Set(7, 7) // 5、6 移动到Main，Main满了：淘汰在Main中没有被访问的 1
+
+	_, ok := cache.Get(1)
+	assert.False(t, ok)
+	_, ok = cache.Get(3)
+	assert.True(t, ok)
+	assert.Equal(t, 3, cache.Main.Len())
+}
+
+func TestS3FIFO_scanResistant(t *testing.T) {
+	const size = 100
+	cache := caches.NewS3FIFOCache[int](size)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < size/2; i++ {
+			if _, ok := cache.Get(i); !ok {
+				cache.Set(i, i)
+			}
+		}
+	}
+	for i := 1000; i < 1000+10*size; i++ { // 一次性的扫描只会经过Small
+		cache.Set(i, i)
+	}
+
+	hits := 0
+	for i := 0; i < size/2; i++ {
+		if _, ok := cache.Get(i); ok {
+			hits++
+		}
+	}
+	assert.Equal(t, size/2, hits)
+}
+
+func TestS3FIFO_invariants(t *testing.T) {
+	const size = 50
+	cache := caches.NewS3FIFOCache[int](size)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100_000; i++ {
+		key := r.Intn(4 * size)
+		if _, ok := cache.Get(key); !ok {
+			cache.Set(key, key)
+		}
+		assert.LessOrEqual(t, cache.Len(), size)
+		assert.LessOrEqual(t, cache.Ghost.Len(), cache.Ghost.Size())
+		if t.Failed() {
+			return
+		}
+	}
+	assert.Equal(t, cache.Len()+cache.Ghost.Len(), len(cache.DataMap))
+}
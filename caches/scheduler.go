@@ -0,0 +1,70 @@
+package caches
+
+import (
+	"sync"
+	"time"
+)
+
+// Scheduler runs a maintenance task in a background goroutine, every interval and whenever it is woken up,
+// so that the maintenance happens even when the cache is idle.
+type Scheduler struct {
+	interval time.Duration
+	task     func()
+	wake     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// NewScheduler starts the goroutine running task. It must be stopped by Stop.
+func NewScheduler(interval time.Duration, task func()) *Scheduler {
+	s := &Scheduler{
+		interval: interval,
+		task:     task,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Scheduler) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		select {
+		case <-s.done: // 同时收到了停止和唤醒
+			return
+		default:
+		}
+		s.task()
+	}
+}
+
+// Wake runs the task soon, without waiting for the next interval. It never blocks.
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default: // 已经有一个唤醒信号了
+	}
+}
+
+// Stop stops the goroutine and waits for the running task to finish. Calling Stop again has no effect.
+// The task itself must not call Stop, which would wait for it forever.
+func (s *Scheduler) Stop() {
+	s.signalStop()
+	<-s.stopped
+}
+
+// signalStop stops the goroutine after the running task, without waiting for it.
+func (s *Scheduler) signalStop() {
+	s.once.Do(func() { close(s.done) })
+}
@@ -0,0 +1,168 @@
+package caches
+
+import (
+	"gaffeine/frequncy_sketch"
+	"gaffeine/global"
+	"gaffeine/utils"
+	"math/bits"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// ShardedCache partitions the keys across independent SizeCache shards, each guarded by its own lock, so that
+// callers on different cores rarely contend. It is safe for concurrent use.
+//
+// A key belongs to the shard selected by the high bits of frequncy_sketch.Hash; the sketch of every shard selects
+// its blocks by the low bits, so the keys of a shard still spread over the whole sketch.
+type ShardedCache[K global.Key] struct {
+	shards       []shard[K]
+	shift        uint // hash >> shift 得到shard的序号
+	heavyHitters int
+}
+
+type shard[K global.Key] struct {
+	mu    sync.Mutex
+	cache *SizeCache[K]
+	stats Stats
+	_     [64]byte // 避免相邻shard的锁位于同一个cache line
+}
+
+// minShardSize is the smallest size of a shard: a SizeCache holds at least 12 entries, the minimums of its segments,
+// so smaller shards would hold more than their share.
+const minShardSize = 12
+
+// DefaultShards returns the number of shards used by default, the smallest power of two not less than GOMAXPROCS.
+func DefaultShards() int {
+	return utils.CeilingPowerOfTwo32(runtime.GOMAXPROCS(0))
+}
+
+// NewShardedCache returns a cache of the given size split evenly across shards, rounded up to a power of two.
+// A non-positive number of shards selects DefaultShards. The shards are halved until each holds at least
+// minShardSize entries, so that the cache holds about size entries: like a SizeCache, it can exceed size by the
+// window, 2% of size, and by the rounding of the shards, up to 3 entries per shard.
+func NewShardedCache[K global.Key](size, shards int) *ShardedCache[K] {
+	if shards <= 0 {
+		shards = DefaultShards()
+	}
+	shards = utils.CeilingPowerOfTwo32(shards)
+	for shards > 1 && size/shards < minShardSize {
+		shards /= 2
+	}
+	shardSize := (size + shards - 1) / shards
+
+	c := &ShardedCache[K]{
+		shards: make([]shard[K], shards),
+		shift:  uint(32 - bits.TrailingZeros(uint(shards))),
+	}
+	for i := range c.shards {
+		c.shards[i].cache = NewSizeCache[K](shardSize)
+	}
+	return c
+}
+
+// ConfigureSketch replaces the sketch of every shard by one built by b, see SizeCache.ConfigureSketch. The heavy
+// hitters tracked by TrackHeavyHitters are kept. It must be called before the cache is shared.
+func (c *ShardedCache[K]) ConfigureSketch(b *frequncy_sketch.Builder[K]) *ShardedCache[K] {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.cache.ConfigureSketch(b)
+		if c.heavyHitters > 0 {
+			s.cache.Sketch.TrackHeavyHitters(c.heavyHitters)
+		}
+		s.mu.Unlock()
+	}
+	return c
+}
+
+// TrackHeavyHitters makes every shard track its k hottest keys, see HeavyHitters. It must be called before the cache
+// is shared.
+func (c *ShardedCache[K]) TrackHeavyHitters(k int) *ShardedCache[K] {
+	c.heavyHitters = k
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.cache.Sketch.TrackHeavyHitters(k)
+		s.mu.Unlock()
+	}
+	return c
+}
+
+func (c *ShardedCache[K]) shardOf(key K) *shard[K] {
+	return &c.shards[uint64(frequncy_sketch.Hash(key))>>c.shift] // shift可能是32，转成uint64避免溢出
+}
+
+func (c *ShardedCache[K]) Get(key K) (interface{}, bool) {
+	s := c.shardOf(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.cache.Get(key)
+	if ok {
+		s.stats.Hits++
+	} else {
+		s.stats.Misses++
+	}
+	return value, ok
+}
+
+func (c *ShardedCache[K]) Set(key K, value interface{}) {
+	s := c.shardOf(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.cache.DataMap)
+	_, exists := s.cache.DataMap[key]
+	s.cache.Set(key, value)
+	if !exists { // 新增的key没有让数量增加时，说明有key被淘汰了
+		s.stats.Evictions += uint64(before + 1 - len(s.cache.DataMap))
+	}
+}
+
+// Shards returns the number of shards.
+func (c *ShardedCache[K]) Shards() int {
+	return len(c.shards)
+}
+
+// Len returns the number of entries of all shards.
+func (c *ShardedCache[K]) Len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += len(s.cache.DataMap)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Stats returns the statistics summed over all shards.
+func (c *ShardedCache[K]) Stats() Stats {
+	var stats Stats
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		stats = stats.Plus(s.stats)
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+// HeavyHitters returns the hottest keys of all shards, see TrackHeavyHitters.
+// The shards hold disjoint keys, so the hottest keys overall are the hottest of the union of the shards.
+func (c *ShardedCache[K]) HeavyHitters() []frequncy_sketch.HeavyHitter[K] {
+	if c.heavyHitters <= 0 {
+		return nil
+	}
+	var all []frequncy_sketch.HeavyHitter[K]
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		all = append(all, s.cache.HeavyHitters()...)
+		s.mu.Unlock()
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Count > all[j].Count })
+	if len(all) > c.heavyHitters {
+		all = all[:c.heavyHitters]
+	}
+	return all
+}
@@ -0,0 +1,117 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	fs "gaffeine/frequncy_sketch"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestShardedCache_construct(t *testing.T) {
+	cache := caches.NewShardedCache[int](1000, 3)
+	assert.Equal(t, 4, cache.Shards())
+
+	cache = caches.NewShardedCache[int](1<<20, 0)
+	assert.Equal(t, caches.DefaultShards(), cache.Shards())
+	assert.GreaterOrEqual(t, caches.DefaultShards(), runtime.GOMAXPROCS(0))
+	assert.Less(t, caches.DefaultShards(), 2*runtime.GOMAXPROCS(0))
+}
+
+func TestShardedCache_setAndGet(t *testing.T) {
+	cache := caches.NewShardedCache[string](100, 4)
+	cache.Set("a", 1)
+	cache.Set("a", 2)
+	v, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+
+	assert.Equal(t, 1, cache.Len())
+	stats := cache.Stats()
+	assert.Equal(t, caches.Stats{Hits: 1, Misses: 1}, stats)
+	assert.Equal(t, uint64(2), stats.Requests())
+	assert.Equal(t, 0.5, stats.HitRatio())
+}
+
+func TestShardedCache_capacityIsSplit(t *testing.T) {
+	single := caches.NewSizeCache[int](100)
+	cache := caches.NewShardedCache[int](800, 8)
+	for i := 0; i < 100_000; i++ {
+		single.Set(i, i)
+		cache.Set(i, i)
+	}
+	// 每个shard的容量是100，每个shard都和单独的SizeCache一样被填满
+	assert.Equal(t, 8*len(single.DataMap), cache.Len())
+	assert.Equal(t, uint64(100_000-cache.Len()), cache.Stats().Evictions)
+}
+
+func TestShardedCache_smallSize(t *testing.T) {
+	assert.Equal(t, 1, caches.NewShardedCache[int](10, 16).Shards())
+	assert.Equal(t, 8, caches.NewShardedCache[int](100, 16).Shards())
+	for _, size := range []int{10, 50, 100, 1000, 5000} {
+		for _, shards := range []int{1, 4, 16, 64} {
+			cache := caches.NewShardedCache[int](size, shards)
+			for i := 0; i < 100_000; i++ {
+				cache.Set(i, i)
+			}
+			// 可以超出window（size的2%）和每个shard取整的3个entry
+			assert.LessOrEqual(t, cache.Len(), size+size/50+3*cache.Shards(), "size %d, %d shards", size, shards)
+		}
+	}
+}
+
+func TestShardedCache_heavyHitters(t *testing.T) {
+	cache := caches.NewShardedCache[int](1000, 8).TrackHeavyHitters(2)
+	for i := 0; i < 100; i++ {
+		cache.Set(i, i)
+	}
+	for i := 0; i < 5; i++ {
+		cache.Get(7)
+		cache.Get(42)
+		cache.Get(42)
+	}
+
+	top := cache.HeavyHitters()
+	assert.Equal(t, 2, len(top))
+	assert.Equal(t, 42, top[0].Key)
+	assert.Equal(t, 7, top[1].Key)
+	assert.Nil(t, caches.NewShardedCache[int](1000, 8).HeavyHitters())
+}
+
+func TestShardedCache_configureSketch(t *testing.T) {
+	cache := caches.NewShardedCache[int](1000, 8).TrackHeavyHitters(1).
+		ConfigureSketch(fs.NewBuilder[int]().Depth(8).CounterBits(8))
+	cache.Set(42, 42)
+	for i := 0; i < 20; i++ {
+		cache.Get(42)
+	}
+
+	top := cache.HeavyHitters() // 仍然统计heavy hitters，8位计数器超过15
+	assert.Equal(t, 1, len(top))
+	assert.Equal(t, 42, top[0].Key)
+	assert.Equal(t, 21, top[0].Count)
+}
+
+func TestShardedCache_concurrent(t *testing.T) {
+	cache := caches.NewShardedCache[int](1000, 8)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10_000; i++ {
+				key := (i*31 + g) % 3000
+				if _, ok := cache.Get(key); !ok {
+					cache.Set(key, i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(8*10_000), cache.Stats().Requests())
+	assert.LessOrEqual(t, cache.Len(), 8*caches.NewSizeCache[int](1000/8).MaximumSize)
+}
@@ -0,0 +1,61 @@
+package caches
+
+import "gaffeine/global"
+
+// SIEVEEvictionPolicy evicts with SIEVE [1]: keys are kept in insertion order and an access only sets a visited bit.
+// To find a victim, a hand moves from the oldest key towards the newest, clearing the visited bits on its way,
+// and stops at the first key that was not visited. Unlike CLOCK the visited keys are not moved,
+// so new keys stay close to the head and are evicted quickly if they are not accessed again.
+//
+// [1] SIEVE is Simpler than LRU: an Efficient Turn-Key Eviction Algorithm for Web Caches
+// https://www.usenix.org/conference/nsdi24/presentation/zhang-yazhuo
+type SIEVEEvictionPolicy[K global.Key] struct {
+	list *LRU[K]     // front is the newest key, back is the oldest
+	hand *Element[K] // nil means the hand starts again from the back
+}
+
+func NewSIEVEPolicy[K global.Key]() *SIEVEEvictionPolicy[K] {
+	return &SIEVEEvictionPolicy[K]{list: NewLRU[K](0, nil)}
+}
+
+func (p *SIEVEEvictionPolicy[K]) OnAccess(ele *Element[K]) {
+	ele.freq = 1
+}
+
+func (p *SIEVEEvictionPolicy[K]) OnInsert(ele *Element[K]) {
+	ele.freq = 0
+	p.list.InsertAtFront(ele)
+}
+
+func (p *SIEVEEvictionPolicy[K]) OnRemove(ele *Element[K]) {
+	if p.hand == ele {
+		p.hand = p.towardsFront(ele)
+	}
+	p.list.Remove(ele)
+}
+
+// Victim moves the hand to the next key that was not visited, clearing the visited bits on its way.
+// The hand stays on the victim, and moves past it once the victim is removed.
+func (p *SIEVEEvictionPolicy[K]) Victim() (*Element[K], bool) {
+	if p.list.Len() == 0 {
+		return nil, false
+	}
+	if p.hand == nil {
+		p.hand = p.list.Back()
+	}
+	for p.hand.freq != 0 {
+		p.hand.freq = 0
+		if p.hand = p.towardsFront(p.hand); p.hand == nil {
+			p.hand = p.list.Back()
+		}
+	}
+	return p.hand, true
+}
+
+// towardsFront returns the element newer than ele, nil if ele is the front.
+func (p *SIEVEEvictionPolicy[K]) towardsFront(ele *Element[K]) *Element[K] {
+	if ele.prev == &p.list.root {
+		return nil
+	}
+	return ele.prev
+}
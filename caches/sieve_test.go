@@ -0,0 +1,66 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSIEVE_evictNotVisited(t *testing.T) {
+	cache := caches.NewPolicyCache[int](3, caches.NewSIEVEPolicy[int]())
+	cache.Set(1, 1)
+	cache.Set(2, 2)
+	cache.Set(3, 3)
+	cache.Get(1)    // 1 被访问过
+	cache.Set(4, 4) // 指针从最旧的 1 开始，清除visited后，淘汰 2
+
+	_, ok := cache.Get(2)
+	assert.False(t, ok)
+	for _, key := range []int{1, 3, 4} {
+		_, ok = cache.Get(key)
+		assert.True(t, ok)
+	}
+}
+
+func TestSIEVE_handKeepsPosition(t *testing.T) {
+	policy := caches.NewSIEVEPolicy[int]()
+	elements := make(map[int]*caches.Element[int])
+	for i := 1; i <= 5; i++ {
+		elements[i] = &caches.Element[int]{Key: i}
+	}
+	for i := 1; i <= 4; i++ {
+		policy.OnInsert(elements[i])
+	}
+	policy.OnAccess(elements[1])
+	policy.OnAccess(elements[2])
+
+	victim, ok := policy.Victim()
+	assert.True(t, ok)
+	assert.Equal(t, 3, victim.Key)
+	policy.OnRemove(victim)
+
+	// 新元素插入到队头，指针继续从 4 开始，而不是从队尾的 1
+	policy.OnInsert(elements[5])
+	policy.OnAccess(elements[4])
+	victim, _ = policy.Victim() // 4 被访问过，清除后移动到 5，5 没有被访问过
+	assert.Equal(t, 5, victim.Key)
+	policy.OnRemove(victim)
+
+	victim, _ = policy.Victim() // 到达队头后回到队尾，1的visited已经被清除
+	assert.Equal(t, 1, victim.Key)
+}
+
+func TestSIEVE_allVisited(t *testing.T) {
+	policy := caches.NewSIEVEPolicy[string]()
+	_, ok := policy.Victim()
+	assert.False(t, ok)
+
+	a, b := &caches.Element[string]{Key: "a"}, &caches.Element[string]{Key: "b"}
+	policy.OnInsert(a)
+	policy.OnInsert(b)
+	policy.OnAccess(a)
+	policy.OnAccess(b)
+	victim, ok := policy.Victim() // 全部被访问过，转一圈后淘汰最旧的
+	assert.True(t, ok)
+	assert.Equal(t, a, victim)
+}
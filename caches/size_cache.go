@@ -7,10 +7,6 @@ import (
 	"time"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 type SizeCache[K global.Key] struct {
 	MaximumSize int
 	DataMap     map[K]*Element[K]
@@ -18,12 +14,17 @@ type SizeCache[K global.Key] struct {
 	Probation   *LRU[K]
 	Protected   *LRU[K]
 	Sketch      *frequncy_sketch.FrequencySketch[K]
+	OnEvict     func(key K, value any) // Set淘汰entry时调用，可以为nil
+	Rand        *rand.Rand             // 频率相同时随机选择淘汰的entry，测试时可以替换为固定seed的Rand
 }
 
-func NewSizeCache[K global.Key](size int) *SizeCache[K] {
+// DefaultWindow is the fraction of a SizeCache given to the admission window by NewSizeCache.
+const DefaultWindow = 0.02
 
-	dataMap := make(map[K]*Element[K])
-	windowSize := int(float32(size) * 0.02)
+// NewSizeCache returns a cache whose window holds DefaultWindow of size, probation 20% and protected 80%. The segments
+// are rounded down, then raised to at least 2, 2 and 8 entries, so MaximumSize may differ from size.
+func NewSizeCache[K global.Key](size int) *SizeCache[K] {
+	windowSize := int(float32(size) * DefaultWindow)
 	probationSize := int(float32(size) * 0.2)
 	protectedSize := probationSize * 4
 	if windowSize <= 0 {
@@ -35,8 +36,38 @@ func NewSizeCache[K global.Key](size int) *SizeCache[K] {
 	if protectedSize <= 0 {
 		protectedSize = 8
 	}
-	maxSize := windowSize + probationSize + protectedSize
+	return newSizeCache[K](windowSize, probationSize, protectedSize)
+}
+
+// NewSizeCacheWindow returns a cache holding exactly size entries, at least 3, of which the given fraction, in (0, 1),
+// goes to the window and the rest to probation (20%) and protected (80%). It lets the simulator compare window sizes,
+// and the policies at the same capacity.
+func NewSizeCacheWindow[K global.Key](size int, window float64) *SizeCache[K] {
+	if size < 3 { // 每个segment至少一个entry
+		size = 3
+	}
+	if window <= 0 || window >= 1 {
+		window = DefaultWindow
+	}
+	windowSize := int(window*float64(size) + 0.5)
+	if windowSize < 1 {
+		windowSize = 1
+	} else if windowSize > size-2 {
+		windowSize = size - 2
+	}
+	main := size - windowSize
+	protectedSize := int(0.8 * float64(main))
+	if protectedSize < 1 {
+		protectedSize = 1
+	} else if protectedSize > main-1 {
+		protectedSize = main - 1
+	}
+	return newSizeCache[K](windowSize, main-protectedSize, protectedSize)
+}
 
+func newSizeCache[K global.Key](windowSize, probationSize, protectedSize int) *SizeCache[K] {
+	dataMap := make(map[K]*Element[K])
+	maxSize := windowSize + probationSize + protectedSize
 	return &SizeCache[K]{
 		MaximumSize: maxSize,
 		DataMap:     dataMap,
@@ -44,6 +75,7 @@ func NewSizeCache[K global.Key](size int) *SizeCache[K] {
 		Probation:   NewLRU(probationSize, dataMap),
 		Protected:   NewLRU(protectedSize, dataMap),
 		Sketch:      frequncy_sketch.New[K]().EnsureCapacity(maxSize),
+		Rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
@@ -60,12 +92,26 @@ func (c *SizeCache[K]) Set(key K, value interface{}) {
 		ele.Value = value
 		return
 	}
+	c.admit(c.insert(key, value))
+}
 
-	ele := c.Window.PushFront(value)
-	ele.Key = key
-
+// insert adds key to the map only, so that it can be read at once. The entry takes part in the eviction once admit
+// adds it to the window.
+func (c *SizeCache[K]) insert(key K, value any) *Element[K] {
+	ele := &Element[K]{Key: key, Value: value, pos: unlinkedPos}
 	c.DataMap[key] = ele
-	c.Sketch.Increment(key)
+	return ele
+}
+
+// admit adds an entry inserted by insert to the window, and evicts as in Set. An entry removed or replaced meanwhile
+// is ignored.
+func (c *SizeCache[K]) admit(ele *Element[K]) {
+	if c.DataMap[ele.Key] != ele {
+		return
+	}
+	c.Window.InsertAtFront(ele)
+	ele.InWindow()
+	c.Sketch.Increment(ele.Key)
 
 	//windowCandidateEle, ok := c.evictFromLRU(c.Window, func() bool { return c.Window.NeedEvict() })
 	windowCandidateEle, ok := c.evictFromLRU(c.Window)
@@ -86,23 +132,31 @@ func (c *SizeCache[K]) Set(key K, value interface{}) {
 	probationFreq := c.Sketch.Frequency(probationCandidateEle.Key)
 
 	if windowFreq < probationFreq { // 直接淘汰window
-		delete(c.DataMap, windowCandidateEle.Key)
+		c.evict(windowCandidateEle)
 	} else if windowFreq > probationFreq { // 淘汰probation，并把windowCandidateEle移动到probation
-		delete(c.DataMap, probationCandidateEle.Key)
-		c.Probation.EvictBack()
+		c.evict(probationCandidateEle)
+		c.Probation.Remove(probationCandidateEle)
 		c.Probation.InsertAtFront(windowCandidateEle)
 		windowCandidateEle.InProbation()
-	} else if rand.Int()%2 == 0 { // 随机淘汰：如果随机数是偶数，淘汰window
-		delete(c.DataMap, windowCandidateEle.Key)
+	} else if c.Rand.Int()%2 == 0 { // 随机淘汰：如果随机数是偶数，淘汰window
+		c.evict(windowCandidateEle)
 	} else {
-		delete(c.DataMap, probationCandidateEle.Key)
-		c.Probation.EvictBack()
+		c.evict(probationCandidateEle)
+		c.Probation.Remove(probationCandidateEle)
 		c.Probation.InsertAtFront(windowCandidateEle)
 		windowCandidateEle.InProbation()
 	}
 	return
 }
 
+// evict removes the victim ele, which is already or about to be removed from its lru, from the cache.
+func (c *SizeCache[K]) evict(ele *Element[K]) {
+	delete(c.DataMap, ele.Key)
+	if c.OnEvict != nil {
+		c.OnEvict(ele.Key, ele.Value)
+	}
+}
+
 func (c *SizeCache[K]) evictFromLRU(lru *LRU[K]) (*Element[K], bool) {
 	if !lru.NeedEvict() {
 		return nil, false
@@ -135,10 +189,105 @@ func (c *SizeCache[K]) peekEvictFromLRU(lru *LRU[K]) (*Element[K], bool) {
 	return backEle, true
 }
 
+// Get returns the value of key and records the access.
+// step:
+// 如果在window中，移动到window的first
+// 如果在probation中，晋升到protected的first；如果protected超出最大数量，把protected的last降级到probation的first
+// 如果在protected中，移动到protected的first
 func (c *SizeCache[K]) Get(key K) (interface{}, bool) {
-	if ele, ok := c.DataMap[key]; ok {
-		c.Sketch.Increment(ele.Key)
-		return ele.Value, true
+	ele, ok := c.DataMap[key]
+	if !ok {
+		return nil, false
+	}
+	c.Sketch.Increment(ele.Key)
+
+	switch {
+	case ele.IsInWindow():
+		c.Window.MoveToFront(ele)
+	case ele.IsInProbation():
+		c.Probation.Remove(ele)
+		c.Protected.InsertAtFront(ele)
+		ele.InProtected()
+		if c.Protected.NeedEvict() { // probation少了一个，protected降级一个，probation的数量不变
+			demoted := c.Protected.Back()
+			c.Protected.Remove(demoted)
+			c.Probation.InsertAtFront(demoted)
+			demoted.InProbation()
+		}
+	case ele.IsInProtected():
+		c.Protected.MoveToFront(ele)
+	}
+	return ele.Value, true
+}
+
+// ConfigureSketch replaces the sketch by one built by b for MaximumSize, e.g. with a larger depth or 8-bit counters,
+// see frequncy_sketch.NewBuilder. The popularity history is forgotten, so it is meant to be called before the cache is used.
+func (c *SizeCache[K]) ConfigureSketch(b *frequncy_sketch.Builder[K]) *SizeCache[K] {
+	c.Sketch = b.MaximumSize(c.MaximumSize).Build()
+	return c
+}
+
+// HeavyHitters returns the hottest keys seen by Get and Set, see FrequencySketch.TrackHeavyHitters.
+func (c *SizeCache[K]) HeavyHitters() []frequncy_sketch.HeavyHitter[K] {
+	return c.Sketch.HeavyHitters()
+}
+
+// Delete removes key from the cache and returns its value, or returns false if key is not cached.
+func (c *SizeCache[K]) Delete(key K) (any, bool) {
+	ele, ok := c.DataMap[key]
+	if !ok {
+		return nil, false
 	}
-	return nil, false
+	switch {
+	case ele.IsInWindow():
+		c.Window.Remove(ele)
+	case ele.IsInProbation():
+		c.Probation.Remove(ele)
+	case ele.IsInProtected():
+		c.Protected.Remove(ele)
+	}
+	delete(c.DataMap, key)
+	return ele.Value, true
+}
+
+// Len returns the number of entries in the cache.
+func (c *SizeCache[K]) Len() int {
+	return len(c.DataMap)
+}
+
+// Range calls f with the entries from the hottest, protected, probation then window, each from its front, until f
+// returns false.
+func (c *SizeCache[K]) Range(f func(ele *Element[K]) bool) {
+	for _, lru := range []*LRU[K]{c.Protected, c.Probation, c.Window} {
+		for ele := lru.Front(); ele != nil; ele = lru.Next(ele) {
+			if !f(ele) {
+				return
+			}
+		}
+	}
+}
+
+// Restore adds key at the back of the segment pos, without recording an access, to rebuild a cache in the order of
+// Range. Like in Set, an entry goes to probation if its segment, protected or window, is full. It returns false if
+// key is already cached or there is no room for it.
+func (c *SizeCache[K]) Restore(key K, value any, pos Position) bool {
+	if _, ok := c.DataMap[key]; ok {
+		return false
+	}
+	ele := &Element[K]{Key: key, Value: value}
+	switch {
+	case pos == ProtectedPos && !c.Protected.IsFull():
+		c.Protected.InsertAtBack(ele)
+		ele.InProtected()
+	case pos == WindowPos && !c.Window.IsFull():
+		c.Window.InsertAtBack(ele)
+		ele.InWindow()
+	case !c.Probation.IsFull():
+		c.Probation.InsertAtBack(ele)
+		ele.InProbation()
+	default:
+		return false
+	}
+	c.DataMap[key] = ele
+	return true
 }
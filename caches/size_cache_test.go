@@ -3,6 +3,8 @@ package caches_test
 import (
 	"gaffeine/caches"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
 	"testing"
 )
 
@@ -28,6 +30,31 @@ func TestConstruct_normal(t *testing.T) {
 	assert.Equal(t, 16, cache.Protected.Size())
 }
 
+func TestConstruct_window(t *testing.T) {
+	for _, size := range []int{3, 10, 100, 1000, 12345} {
+		for _, window := range []float64{0.01, caches.DefaultWindow, 0.2, 0.5, 0.99} {
+			cache := caches.NewSizeCacheWindow[string](size, window)
+			assert.Equal(t, size, cache.MaximumSize)
+			assert.Equal(t, size, cache.Window.Size()+cache.Probation.Size()+cache.Protected.Size())
+			assert.GreaterOrEqual(t, cache.Window.Size(), 1)
+			assert.GreaterOrEqual(t, cache.Probation.Size(), 1)
+			assert.GreaterOrEqual(t, cache.Protected.Size(), 1)
+		}
+	}
+	cache := caches.NewSizeCacheWindow[string](1000, 0.1)
+	assert.Equal(t, 100, cache.Window.Size())
+	assert.Equal(t, 180, cache.Probation.Size())
+	assert.Equal(t, 720, cache.Protected.Size())
+
+	cache = caches.NewSizeCacheWindow[string](1, 0)
+	assert.Equal(t, 3, cache.MaximumSize)
+	for i := 0; i < 100; i++ {
+		cache.Set(strconv.Itoa(i), i)
+		cache.Get(strconv.Itoa(i / 2))
+		assert.LessOrEqual(t, cache.Len(), 3)
+	}
+}
+
 func TestSet_new(t *testing.T) {
 	cache := makeSizeCache(4)
 
@@ -149,3 +176,109 @@ func TestGet_foundAndIncrementFrequency(t *testing.T) {
 	assert.Equal(t, 10, v.(int))
 	assert.Equal(t, 2, cache.Sketch.Frequency(key))
 }
+
+func TestDelete(t *testing.T) {
+	cache := makeSizeCache(4)
+	for i := 0; i < 4; i++ {
+		cache.Set(strconv.Itoa(i), i) // window: 3, 2; probation: 1, 0
+	}
+	cache.Get("0") // 晋升到protected
+
+	for _, key := range []string{"3", "1", "0"} { // window、probation、protected中各删除一个
+		v, ok := cache.Delete(key)
+		assert.True(t, ok)
+		assert.Equal(t, key, strconv.Itoa(v.(int)))
+	}
+	_, ok := cache.Delete("0")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+	assert.Equal(t, 1, cache.Window.Len()+cache.Probation.Len()+cache.Protected.Len())
+}
+
+func TestSet_onEvict(t *testing.T) {
+	cache := makeSizeCache(4)
+	evicted := make(map[string]any)
+	cache.OnEvict = func(key string, value any) { evicted[key] = value }
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+
+	assert.Equal(t, 10-cache.Len(), len(evicted))
+	for key, value := range evicted {
+		_, ok := cache.DataMap[key]
+		assert.False(t, ok)
+		assert.Equal(t, key, strconv.Itoa(value.(int)))
+	}
+}
+
+// keysOf returns the keys of lru from its front.
+func keysOf(lru *caches.LRU[string]) []string {
+	var keys []string
+	for ele := lru.Front(); ele != nil; ele = lru.Next(ele) {
+		keys = append(keys, ele.Key)
+	}
+	return keys
+}
+
+func TestGet_promoteProbationToProtected(t *testing.T) {
+	cache := makeSizeCache(4)
+	for i := 0; i < 4; i++ {
+		cache.Set(strconv.Itoa(i), i) // window: 3, 2; probation: 1, 0
+	}
+
+	v, ok := cache.Get("0")
+	assert.True(t, ok)
+	assert.Equal(t, 0, v.(int))
+	assert.True(t, cache.DataMap["0"].IsInProtected())
+	assert.Equal(t, []string{"0"}, keysOf(cache.Protected))
+	assert.Equal(t, []string{"1"}, keysOf(cache.Probation))
+
+	cache.Get("2") // window中的key留在window，移动到front
+	assert.Equal(t, []string{"2", "3"}, keysOf(cache.Window))
+}
+
+func TestGet_demoteProtectedBackToProbation(t *testing.T) {
+	cache := makeSizeCache(4) // protected: 8
+	for i := 0; i < 8; i++ {
+		cache.Restore("p"+strconv.Itoa(i), i, caches.ProtectedPos)
+	}
+	cache.Restore("b0", 0, caches.ProbationPos)
+	cache.Restore("b1", 1, caches.ProbationPos)
+
+	cache.Get("b1") // protected超出，p7降级到probation的front
+	assert.Equal(t, []string{"b1", "p0", "p1", "p2", "p3", "p4", "p5", "p6"}, keysOf(cache.Protected))
+	assert.Equal(t, []string{"p7", "b0"}, keysOf(cache.Probation))
+	assert.True(t, cache.DataMap["p7"].IsInProbation())
+	assert.Equal(t, 10, cache.Len())
+}
+
+func TestSet_removeProbationVictim(t *testing.T) {
+	cache := makeSizeCache(4)
+	var evicted []string
+	cache.OnEvict = func(key string, value any) { evicted = append(evicted, key) }
+	cache.Restore("b0", 0, caches.ProbationPos)
+	cache.Restore("b1", 1, caches.ProbationPos) // probation正好满了
+	cache.Set("w0", 0)
+	cache.Set("w1", 1)
+	cache.Sketch.Increment("w0")
+
+	cache.Set("w2", 2) // w0的频率高于probation的victim b1
+	assert.Equal(t, []string{"b1"}, evicted)
+	assert.Equal(t, []string{"w0", "b0"}, keysOf(cache.Probation))
+	assert.Equal(t, []string{"w2", "w1"}, keysOf(cache.Window))
+	assert.Equal(t, 4, cache.Len())
+	_, ok := cache.DataMap["b1"]
+	assert.False(t, ok)
+}
+
+func TestSet_seededTieBreaks(t *testing.T) {
+	contents := func() []string {
+		cache := makeSizeCache(4)
+		cache.Rand = rand.New(rand.NewSource(1))
+		for i := 0; i < 100; i++ {
+			cache.Set(strconv.Itoa(i), i) // 频率都是1，随机淘汰
+		}
+		return append(keysOf(cache.Window), keysOf(cache.Probation)...)
+	}
+	assert.Equal(t, contents(), contents())
+}
@@ -0,0 +1,200 @@
+package caches
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gaffeine/frequncy_sketch"
+	"io"
+	"sort"
+	"time"
+)
+
+// ErrSnapshot is wrapped by the errors of LoadFrom about invalid snapshots.
+var ErrSnapshot = errors.New("caches: invalid snapshot")
+
+const (
+	snapshotMagic   = "gaffeine snapshot"
+	snapshotVersion = 1
+)
+
+// A snapshot is a gob stream of a snapshotHeader followed by its Entries snapshotEntry, from the hottest.
+type snapshotHeader struct {
+	Magic   string
+	Version int
+	SavedAt time.Time
+	Sketch  []byte // FrequencySketch.MarshalBinary
+	Entries int
+}
+
+type snapshotEntry[K any] struct {
+	Key     K
+	Segment Position      // WindowPos, ProbationPos or ProtectedPos
+	Age     time.Duration // 写入之后经过的时间
+	TTL     time.Duration // SavedAt时剩余的过期时间，0表示不过期
+	Value   []byte        // Codec编码的值
+}
+
+// SaveTo writes a snapshot of the cache to w: the state of the FrequencySketch, and the entries not expired in the
+// order of SizeCache.Range, from the hottest, with their age and remaining time to live. The values are encoded by
+// the Codec of the cache. It does not block the cache while writing.
+func (c *ManagedCache[K]) SaveTo(w io.Writer) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	type saved struct {
+		entry snapshotEntry[K]
+		value any
+	}
+	c.mu.Lock()
+	c.drainLocked() // Range只包含已经加入window的entry
+	sketch, err := c.cache.Sketch.MarshalBinary()
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	now := c.Now()
+	entries := make([]saved, 0, c.cache.Len())
+	c.cache.Range(func(ele *Element[K]) bool {
+		entry := ele.Value.(*managedEntry[K])
+		if c.expired(entry) {
+			return true
+		}
+		s := saved{entry: snapshotEntry[K]{Key: entry.key, Segment: ele.pos, Age: now.Sub(entry.writtenAt)}, value: entry.value}
+		if c.expireAfterWrite > 0 {
+			s.entry.TTL = entry.expiresAt.Sub(now)
+		}
+		entries = append(entries, s)
+		return true
+	})
+	c.mu.Unlock()
+
+	encoder := gob.NewEncoder(w) // 在锁外面编码
+	header := snapshotHeader{
+		Magic:   snapshotMagic,
+		Version: snapshotVersion,
+		SavedAt: now,
+		Sketch:  sketch,
+		Entries: len(entries),
+	}
+	if err := encoder.Encode(&header); err != nil {
+		return err
+	}
+	for i := range entries {
+		data, err := c.codec.Encode(entries[i].value)
+		if err != nil {
+			return fmt.Errorf("caches: encoding the value of %v: %w", entries[i].entry.Key, err)
+		}
+		entries[i].entry.Value = data
+		if err := encoder.Encode(&entries[i].entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFrom restores a snapshot written by SaveTo, typically into a new cache at startup: it restores the counters
+// of the FrequencySketch, see restoreSketch, and adds the entries to their segments, from the hottest, as long as there is room for them.
+// The time since the snapshot was saved counts in the age of the entries, whose expiration is not extended by the
+// restart. The keys already cached, and the entries expired meanwhile, are skipped. An entry saved without
+// expiration expires after ExpireAfterWrite from the time it was written, if the cache has one. Neither the removal listener
+// nor the writer is called. On error, the cache is left unchanged.
+func (c *ManagedCache[K]) LoadFrom(r io.Reader) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	decoder := gob.NewDecoder(r)
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return fmt.Errorf("%w: %v", ErrSnapshot, err)
+	}
+	if header.Magic != snapshotMagic || header.Version != snapshotVersion {
+		return fmt.Errorf("%w: version %q %d", ErrSnapshot, header.Magic, header.Version)
+	}
+	if header.Entries < 0 {
+		return fmt.Errorf("%w: %d entries", ErrSnapshot, header.Entries)
+	}
+	sketch := frequncy_sketch.New[K]()
+	if err := sketch.UnmarshalBinary(header.Sketch); err != nil {
+		return fmt.Errorf("%w: %w", ErrSnapshot, err)
+	}
+	// 不按照header分配，一个损坏的数量可能耗尽内存，文件中没有那么多entry时Decode会失败
+	var entries []snapshotEntry[K]
+	var values []any
+	for i := 0; i < header.Entries; i++ {
+		var entry snapshotEntry[K]
+		if err := decoder.Decode(&entry); err != nil {
+			return fmt.Errorf("%w: entry %d: %v", ErrSnapshot, i, err)
+		}
+		value, err := c.codec.Decode(entry.Value)
+		if err != nil {
+			return fmt.Errorf("caches: decoding the value of %v: %w", entry.Key, err)
+		}
+		entries = append(entries, entry)
+		values = append(values, value)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drainLocked()
+	c.restoreSketch(sketch)
+	now := c.Now()
+	elapsed := now.Sub(header.SavedAt) // 保存之后经过的时间
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	var expiring []*managedEntry[K]
+	for i, e := range entries {
+		age := e.Age + elapsed
+		entry := &managedEntry[K]{key: e.Key, value: values[i], writtenAt: now.Add(-age)}
+		if c.expireAfterWrite > 0 {
+			ttl := c.expireAfterWrite - age
+			if e.TTL > 0 && e.TTL-elapsed < ttl {
+				ttl = e.TTL - elapsed
+			}
+			if ttl <= 0 {
+				continue
+			}
+			entry.expiresAt = now.Add(ttl)
+		}
+		if c.cache.Restore(e.Key, entry, e.Segment) && c.expireAfterWrite > 0 {
+			expiring = append(expiring, entry)
+		}
+	}
+	c.mergeExpiry(expiring)
+	return nil
+}
+
+// restoreSketch replaces the counters of the sketch of the cache with the saved ones. The position of the counters
+// of a key depends on the length of the table, the depth and the counter width, so the counters of a cache of another
+// size cannot be mapped: the saved popularity history is dropped then, and the sketch is left unchanged. The sketch
+// keeps its own sample size and update mode. When the counters are replaced, the heavy hitters tracked so far are
+// forgotten, since their counts came from the replaced counters.
+func (c *ManagedCache[K]) restoreSketch(saved *frequncy_sketch.FrequencySketch[K]) {
+	sketch := c.cache.Sketch
+	if len(saved.Table) == len(sketch.Table) && saved.Depth() == sketch.Depth() &&
+		saved.MaxFrequency() == sketch.MaxFrequency() {
+		copy(sketch.Table, saved.Table)
+		sketch.Size = saved.Size
+		if sketch.Size >= sketch.SampleSize { // 保存的cache的sample size可能更大
+			sketch.Reset()
+		}
+		sketch.TrackHeavyHitters(c.heavyHitters) // 旧的计数不再对应sketch中的计数器
+	}
+}
+
+// mergeExpiry adds the entries to the expiry list, which stays ordered by expiration.
+func (c *ManagedCache[K]) mergeExpiry(entries []*managedEntry[K]) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].expiresAt.Before(entries[j].expiresAt) })
+	next := c.expiry.Front()
+	for _, entry := range entries {
+		for next != nil && !entry.expiresAt.Before(next.Value.(*managedEntry[K]).expiresAt) {
+			next = next.Next()
+		}
+		if next == nil {
+			entry.expiry = c.expiry.PushBack(entry)
+		} else {
+			entry.expiry = c.expiry.InsertBefore(entry, next)
+		}
+	}
+}
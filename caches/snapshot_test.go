@@ -0,0 +1,189 @@
+package caches_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// keys returns the keys of cache in the order of SizeCache.Range, with their segments.
+func keys(cache *caches.ManagedCache[string]) (keys []string, segments []bool) {
+	sc := cache.SizeCache()
+	sc.Range(func(ele *caches.Element[string]) bool {
+		keys = append(keys, ele.Key)
+		segments = append(segments, ele.IsInProtected())
+		return true
+	})
+	return keys, segments
+}
+
+func TestSnapshot_roundTrip(t *testing.T) {
+	clock := newFakeClock()
+	saved := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{ExpireAfterWrite: time.Hour})
+	saved.Now = clock.Now
+	for i := 0; i < 50; i++ {
+		saved.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 50; i += 3 { // 晋升到protected
+		saved.Get(strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, saved.SaveTo(&buf))
+
+	loaded := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{ExpireAfterWrite: time.Hour, HeavyHitters: 3})
+	loaded.Now = clock.Now
+	loaded.Set("hot", 0)
+	loaded.Get("hot")
+	assert.Nil(t, loaded.CleanUp())
+	assert.NotEmpty(t, loaded.HeavyHitters())
+	loaded.Invalidate("hot")
+	assert.Nil(t, loaded.LoadFrom(&buf))
+	assert.Equal(t, saved.Len(), loaded.Len())
+	assert.Empty(t, loaded.HeavyHitters()) // 计数器被替换，之前的计数不再对应sketch
+	savedKeys, savedSegments := keys(saved)
+	loadedKeys, loadedSegments := keys(loaded)
+	assert.Equal(t, savedKeys, loadedKeys) // 顺序和segment都相同
+	assert.Equal(t, savedSegments, loadedSegments)
+	for _, key := range savedKeys {
+		assert.Equal(t, saved.SizeCache().Sketch.Frequency(key), loaded.SizeCache().Sketch.Frequency(key))
+		value, ok := loaded.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, key, strconv.Itoa(value.(int)))
+	}
+}
+
+func TestSnapshot_remainingTTL(t *testing.T) {
+	clock := newFakeClock()
+	saved := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{ExpireAfterWrite: time.Hour})
+	saved.Now = clock.Now
+	saved.Set("a", 1)
+	clock.Advance(30 * time.Minute)
+	saved.Set("b", 2)
+	clock.Advance(10 * time.Minute)
+	var buf bytes.Buffer
+	assert.Nil(t, saved.SaveTo(&buf))
+
+	clock.Advance(10 * time.Minute) // 重启花了10分钟
+	loaded := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{ExpireAfterWrite: time.Hour})
+	loaded.Now = clock.Now
+	loaded.Set("c", 3)
+	assert.Nil(t, loaded.LoadFrom(&buf))
+	assert.Equal(t, 3, loaded.Len())
+
+	clock.Advance(10 * time.Minute) // a写入之后一个小时
+	assert.Nil(t, loaded.CleanUp())
+	assert.Equal(t, 2, loaded.Len())
+	_, ok := loaded.Get("a")
+	assert.False(t, ok)
+
+	clock.Advance(30 * time.Minute) // b写入之后一个小时，c还没有过期
+	assert.Nil(t, loaded.CleanUp())
+	_, ok = loaded.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 1, loaded.Len())
+}
+
+func TestSnapshot_hottestFirst(t *testing.T) {
+	saved := caches.NewManagedCache[string](1000, caches.ManagedConfig[string]{})
+	for i := 0; i < 1000; i++ {
+		saved.Set(strconv.Itoa(i), i)
+		saved.Get(strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, saved.SaveTo(&buf))
+
+	loaded := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{})
+	assert.Nil(t, loaded.LoadFrom(&buf))
+	savedKeys, _ := keys(saved)
+	loadedKeys, _ := keys(loaded)
+	protected := loaded.SizeCache().Protected.Len() + loaded.SizeCache().Probation.Len()
+	assert.Equal(t, savedKeys[:protected], loadedKeys[:protected]) // 保留最热的entry
+}
+
+func TestSnapshot_otherSize(t *testing.T) {
+	saved := caches.NewManagedCache[string](1000, caches.ManagedConfig[string]{})
+	for i := 0; i < 1000; i++ {
+		saved.Set(strconv.Itoa(i), i)
+		saved.Get(strconv.Itoa(i))
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, saved.SaveTo(&buf))
+
+	loaded := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{HeavyHitters: 5})
+	sketch := loaded.SizeCache().Sketch
+	tableLength, sampleSize := len(sketch.Table), sketch.SampleSize
+	loaded.Set("hot", 0)
+	for i := 0; i < 10; i++ {
+		loaded.Get("hot")
+	}
+	assert.Nil(t, loaded.CleanUp())
+	assert.NotEmpty(t, loaded.HeavyHitters())
+
+	assert.Nil(t, loaded.LoadFrom(&buf))
+	sketch = loaded.SizeCache().Sketch
+	assert.Equal(t, tableLength, len(sketch.Table)) // sketch的维度不变，保存的计数器被丢弃
+	assert.Equal(t, sampleSize, sketch.SampleSize)
+	assert.Equal(t, 0, sketch.Frequency("0"))
+	assert.Equal(t, 11, sketch.Frequency("hot"))
+	assert.Equal(t, "hot", loaded.HeavyHitters()[0].Key)
+	assert.Positive(t, loaded.Len())
+
+	for i := 0; i < 1000; i++ { // 恢复之后cache正常工作
+		loaded.Set(strconv.Itoa(i), i)
+		loaded.Get(strconv.Itoa(i))
+	}
+	assert.Nil(t, loaded.CleanUp())
+	assert.LessOrEqual(t, loaded.Len(), 100)
+	assert.Len(t, loaded.HeavyHitters(), 5)
+}
+
+type failingCodec struct{}
+
+func (failingCodec) Encode(value any) ([]byte, error) {
+	if value == "bad" {
+		return nil, errors.New("cannot encode")
+	}
+	return []byte(value.(string)), nil
+}
+
+func (failingCodec) Decode(data []byte) (any, error) {
+	return string(data), nil
+}
+
+func TestSnapshot_errors(t *testing.T) {
+	cache := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{Codec: failingCodec{}})
+	cache.Set("a", "value")
+	var buf bytes.Buffer
+	assert.Nil(t, cache.SaveTo(&buf))
+	loaded := caches.NewManagedCache[string](100, caches.ManagedConfig[string]{Codec: failingCodec{}})
+	assert.Nil(t, loaded.LoadFrom(bytes.NewReader(buf.Bytes())))
+	value, _ := loaded.Get("a")
+	assert.Equal(t, "value", value)
+
+	assert.True(t, errors.Is(loaded.LoadFrom(bytes.NewReader(buf.Bytes()[:buf.Len()/2])), caches.ErrSnapshot))
+	assert.True(t, errors.Is(loaded.LoadFrom(bytes.NewReader([]byte("garbage"))), caches.ErrSnapshot))
+
+	for _, entries := range []int{-1, 1 << 40} {
+		var corrupt bytes.Buffer
+		assert.Nil(t, gob.NewEncoder(&corrupt).Encode(struct {
+			Magic   string
+			Version int
+			Entries int
+		}{"gaffeine snapshot", 1, entries}))
+		assert.True(t, errors.Is(loaded.LoadFrom(&corrupt), caches.ErrSnapshot))
+	}
+	value, _ = loaded.Get("a") // cache不变
+	assert.Equal(t, "value", value)
+
+	cache.Set("b", "bad")
+	assert.EqualError(t, cache.SaveTo(&bytes.Buffer{}), "caches: encoding the value of b: cannot encode")
+
+	assert.Nil(t, cache.Close())
+	assert.Equal(t, caches.ErrClosed, cache.SaveTo(&buf))
+	assert.Equal(t, caches.ErrClosed, cache.LoadFrom(&buf))
+}
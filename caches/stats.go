@@ -0,0 +1,30 @@
+package caches
+
+// Stats are the statistics of a cache.
+type Stats struct {
+	Hits      uint64 // Get found the key
+	Misses    uint64 // Get did not find the key
+	Evictions uint64 // entries evicted to make room for new ones
+}
+
+// Requests returns the number of Get calls.
+func (s Stats) Requests() uint64 {
+	return s.Hits + s.Misses
+}
+
+// HitRatio returns the fraction of Get calls that found the key, or 1 if there was no Get.
+func (s Stats) HitRatio() float64 {
+	if s.Requests() == 0 {
+		return 1
+	}
+	return float64(s.Hits) / float64(s.Requests())
+}
+
+// Plus returns the sum of both statistics.
+func (s Stats) Plus(other Stats) Stats {
+	return Stats{
+		Hits:      s.Hits + other.Hits,
+		Misses:    s.Misses + other.Misses,
+		Evictions: s.Evictions + other.Evictions,
+	}
+}
@@ -0,0 +1,98 @@
+package caches_test
+
+import (
+	"flag"
+	"fmt"
+	"gaffeine/caches"
+	"gaffeine/global"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// The throughput harness runs the mixed workload of the benchmarks on every design for a fixed duration with an
+// increasing number of goroutines, and prints ops/sec, allocations and hit ratio:
+// go test ./caches -v -run TestThroughput -throughput 1s
+var throughputDuration = flag.Duration("throughput", 0, "run the throughput harness for this long per configuration")
+
+const throughputCacheSize = 10_000
+
+type throughputResult struct {
+	ops, hits, gets uint64
+	mallocs         uint64
+	elapsed         time.Duration
+}
+
+// measureThroughput runs the mixed workload on cache with the given number of goroutines for duration.
+func measureThroughput[K global.Key](cache caches.Cache[K], keys []K, goroutines int, duration time.Duration) throughputResult {
+	var (
+		stop            int32
+		ops, hits, gets uint64
+		wg              sync.WaitGroup
+		before, after   runtime.MemStats
+	)
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			var localOps, localHits, localGets uint64
+			for i := offset; atomic.LoadInt32(&stop) == 0; i++ {
+				for j := 0; j < 64; j++ { // 每64次操作检查一次是否结束
+					key := keys[(i*64+j)&(benchKeys-1)]
+					if j&3 == 0 {
+						cache.Set(key, j)
+					} else {
+						localGets++
+						if _, ok := cache.Get(key); ok {
+							localHits++
+						}
+					}
+				}
+				localOps += 64
+			}
+			atomic.AddUint64(&ops, localOps)
+			atomic.AddUint64(&hits, localHits)
+			atomic.AddUint64(&gets, localGets)
+		}(g * 7919)
+	}
+	time.Sleep(duration)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return throughputResult{ops: ops, hits: hits, gets: gets, mallocs: after.Mallocs - before.Mallocs, elapsed: elapsed}
+}
+
+func TestThroughput(t *testing.T) {
+	if *throughputDuration == 0 {
+		t.Skip("run with -throughput <duration> to measure the throughput")
+	}
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "design\tkey\tgoroutines\tops/sec\tallocs/op\thit ratio\t")
+	report := func(name, key string, goroutines int, r throughputResult) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.0f\t%.3f\t%.4f\t\n", name, key, goroutines,
+			float64(r.ops)/r.elapsed.Seconds(), float64(r.mallocs)/float64(r.ops), float64(r.hits)/float64(r.gets))
+	}
+
+	intKeys, stringKeys := zipfKeys(throughputCacheSize, intKey), zipfKeys(throughputCacheSize, stringKey)
+	for _, goroutines := range []int{1, 2, 4, 8, 16} {
+		for _, design := range benchDesigns[int]() {
+			cache := design.guard(warmCache(design.newCache(throughputCacheSize), intKeys))
+			report(design.name, "int", goroutines, measureThroughput[int](cache, intKeys, goroutines, *throughputDuration))
+		}
+		for _, design := range benchDesigns[string]() {
+			cache := design.guard(warmCache(design.newCache(throughputCacheSize), stringKeys))
+			report(design.name, "string", goroutines, measureThroughput[string](cache, stringKeys, goroutines, *throughputDuration))
+		}
+	}
+	w.Flush()
+	t.Log("\n" + table.String())
+}
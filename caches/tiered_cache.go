@@ -0,0 +1,143 @@
+package caches
+
+import (
+	"errors"
+	"gaffeine/global"
+	"sync"
+)
+
+// TieredStats are the statistics of a TieredCache.
+type TieredStats struct {
+	Stats         // Hits在L1或者L2中找到，Evictions是L2删除或者不能写入L2的entry
+	L2Hits uint64 // Get found the key in L2
+	Spills uint64 // entries evicted from L1 and written to L2
+	Errors uint64 // failed encodings, decodings and disk operations, which are handled as misses
+	Lost   uint64 // entries of L2 that could not be read back or decoded, and were dropped
+}
+
+// TieredCache is a SizeCache (L1) whose victims are spilled to a DiskStore (L2) rather than dropped. A Get missing
+// in L1 looks the key up in L2, and promotes it back to L1 on hit. Values are serialized by a Codec, so the values
+// set must be of type V: other values are only kept in L1.
+//
+// The cache is safe for concurrent use, and must be closed when done, which deletes L2. L2 does not survive a restart,
+// see DiskStore.
+type TieredCache[K global.Key, V any] struct {
+	mu    sync.Mutex
+	l1    *SizeCache[K]
+	l2    *DiskStore[K]
+	codec Codec[V]
+	stats TieredStats
+}
+
+// NewTieredCache returns a cache of the given size in memory, spilling to a DiskStore in dir.
+func NewTieredCache[K global.Key, V any](size int, dir string, config DiskConfig, codec Codec[V]) (*TieredCache[K, V], error) {
+	l2, err := NewDiskStore[K](dir, config)
+	if err != nil {
+		return nil, err
+	}
+	c := &TieredCache[K, V]{l1: NewSizeCache[K](size), l2: l2, codec: codec}
+	c.l1.OnEvict = c.spill
+	return c, nil
+}
+
+// spill writes a victim of L1 to L2.
+func (c *TieredCache[K, V]) spill(key K, value any) {
+	v, ok := value.(V)
+	if !ok {
+		c.stats.Evictions++
+		return
+	}
+	data, err := c.codec.Encode(v)
+	if err == nil {
+		err = c.l2.Put(key, data)
+	}
+	if err != nil {
+		c.stats.Errors++
+		c.stats.Evictions++
+		return
+	}
+	c.stats.Spills++
+}
+
+func (c *TieredCache[K, V]) Get(key K) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if value, ok := c.l1.Get(key); ok {
+		c.stats.Hits++
+		return value, true
+	}
+	value, ok := c.getL2(key)
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.stats.L2Hits++
+	c.l1.Set(key, value) // 晋升到L1，可能把其它entry淘汰到L2
+	return value, true
+}
+
+// getL2 removes key from L2 and returns its value.
+func (c *TieredCache[K, V]) getL2(key K) (V, bool) {
+	var zero V
+	data, ok, err := c.l2.Get(key)
+	if err != nil {
+		c.stats.Errors++
+		if errors.Is(err, ErrCorrupted) { // DiskStore删除了损坏的记录
+			c.stats.Lost++
+		}
+	}
+	if !ok {
+		return zero, false
+	}
+	c.l2.Delete(key)
+	value, err := c.codec.Decode(data)
+	if err != nil {
+		c.stats.Errors++
+		c.stats.Lost++
+		return zero, false
+	}
+	return value, true
+}
+
+func (c *TieredCache[K, V]) Set(key K, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.l2.Delete(key) // L2中的值已经过时了
+	c.l1.Set(key, value)
+}
+
+// Invalidate removes key from both tiers.
+func (c *TieredCache[K, V]) Invalidate(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.l1.Delete(key)
+	c.l2.Delete(key)
+}
+
+// Len returns the number of entries in L1 and in L2.
+func (c *TieredCache[K, V]) Len() (l1, l2 int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.l1.Len(), c.l2.Len()
+}
+
+// Stats returns the statistics of the cache. The entries deleted with the oldest segments of L2 are not counted
+// as evictions.
+func (c *TieredCache[K, V]) Stats() TieredStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// L2 returns the disk store of the cache.
+func (c *TieredCache[K, V]) L2() *DiskStore[K] {
+	return c.l2
+}
+
+// Close deletes L2. The cache must not be used afterwards.
+func (c *TieredCache[K, V]) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.l2.Close()
+}
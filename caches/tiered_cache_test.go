@@ -0,0 +1,101 @@
+package caches_test
+
+import (
+	"errors"
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestTieredCache_spillAndPromote(t *testing.T) {
+	cache, err := caches.NewTieredCache[string, string](100, t.TempDir(), caches.DiskConfig{}, caches.GobCodec[string]{})
+	assert.Nil(t, err)
+	defer cache.Close()
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(strconv.Itoa(i), "value"+strconv.Itoa(i))
+	}
+	l1, l2 := cache.Len()
+	assert.Equal(t, 1000, l1+l2) // 没有丢失任何entry
+	assert.Equal(t, uint64(l2), cache.Stats().Spills)
+
+	for i := 0; i < 1000; i++ {
+		value, ok := cache.Get(strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.Equal(t, "value"+strconv.Itoa(i), value)
+	}
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1000), stats.Hits)
+	assert.Less(t, uint64(900), stats.L2Hits)
+	assert.Equal(t, uint64(0), stats.Errors)
+
+	_, ok := cache.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestTieredCache_setReplacesL2(t *testing.T) {
+	cache, err := caches.NewTieredCache[int, []byte](10, t.TempDir(), caches.DiskConfig{}, caches.BytesCodec{})
+	assert.Nil(t, err)
+	defer cache.Close()
+
+	for i := 0; i < 100; i++ {
+		cache.Set(i, []byte("old"))
+	}
+	_, l2 := cache.Len()
+	assert.Less(t, 0, l2)
+	for i := 0; i < 100; i++ {
+		cache.Set(i, []byte("new"))
+	}
+	for i := 0; i < 100; i++ {
+		value, _ := cache.Get(i)
+		assert.Equal(t, []byte("new"), value)
+	}
+
+	cache.Invalidate(1)
+	_, ok := cache.Get(1)
+	assert.False(t, ok)
+}
+
+func TestTieredCache_valuesOfAnotherType(t *testing.T) {
+	cache, err := caches.NewTieredCache[int, string](10, t.TempDir(), caches.DiskConfig{}, caches.GobCodec[string]{})
+	assert.Nil(t, err)
+	defer cache.Close()
+
+	for i := 0; i < 100; i++ {
+		cache.Set(i, i) // 不是string，不能写入L2
+	}
+	l1, l2 := cache.Len()
+	assert.Equal(t, 0, l2)
+	assert.Equal(t, uint64(100-l1), cache.Stats().Evictions)
+}
+
+// undecodable is a Codec whose values cannot be decoded.
+type undecodable struct {
+	caches.GobCodec[string]
+}
+
+func (undecodable) Decode(data []byte) (string, error) {
+	return "", errors.New("undecodable")
+}
+
+func TestTieredCache_decodeLoss(t *testing.T) {
+	cache, err := caches.NewTieredCache[int, string](10, t.TempDir(), caches.DiskConfig{}, undecodable{})
+	assert.Nil(t, err)
+	defer cache.Close()
+
+	for i := 0; i < 100; i++ {
+		cache.Set(i, strconv.Itoa(i))
+	}
+	_, l2 := cache.Len()
+	assert.Less(t, 0, l2)
+	for i := 0; i < 100; i++ {
+		cache.Get(i)
+	}
+	stats := cache.Stats()
+	assert.Equal(t, uint64(l2), stats.Lost) // 从L2删除之后解码失败，entry丢失
+	assert.Equal(t, uint64(l2), stats.Misses)
+	assert.Equal(t, uint64(0), stats.Evictions)
+	_, l2 = cache.Len()
+	assert.Equal(t, 0, l2)
+}
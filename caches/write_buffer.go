@@ -0,0 +1,103 @@
+package caches
+
+import (
+	"gaffeine/utils"
+	"sync/atomic"
+)
+
+// WriteBuffer is a bounded multi-producer single-consumer queue of the writes waiting to be applied to the policy,
+// like the write buffer of Caffeine. It never drops: Offer reports a full buffer, and the producer is expected to
+// drain it, or wait for the consumer to do so, and offer again.
+//
+// It is the bounded queue of Dmitry Vyukov, where every slot carries a sequence number telling producers and the
+// consumer whose turn it is.
+type WriteBuffer[T any] struct {
+	mask  uint64
+	slots []writeSlot[T]
+	_     [64]byte
+	tail  atomic.Uint64 // 生产者的位置
+	_     [56]byte
+	head  atomic.Uint64 // 消费者的位置，只有消费者修改
+}
+
+type writeSlot[T any] struct {
+	// sequence == position：生产者可以写入；sequence == position+1：消费者可以读取
+	sequence atomic.Uint64
+	value    T
+}
+
+// NewWriteBuffer returns a buffer of the given capacity, rounded up to a power of two.
+func NewWriteBuffer[T any](capacity int) *WriteBuffer[T] {
+	if capacity < 2 {
+		capacity = 2
+	}
+	capacity = utils.CeilingPowerOfTwo32(capacity)
+	b := &WriteBuffer[T]{
+		mask:  uint64(capacity - 1),
+		slots: make([]writeSlot[T], capacity),
+	}
+	for i := range b.slots {
+		b.slots[i].sequence.Store(uint64(i))
+	}
+	return b
+}
+
+// Offer adds e to the buffer, or returns false if the buffer is full. It is safe for concurrent use.
+func (b *WriteBuffer[T]) Offer(e T) bool {
+	for {
+		tail := b.tail.Load()
+		slot := &b.slots[tail&b.mask]
+		switch diff := int64(slot.sequence.Load() - tail); {
+		case diff == 0: // 轮到这个位置，抢占后写入
+			if b.tail.CompareAndSwap(tail, tail+1) {
+				slot.value = e
+				slot.sequence.Store(tail + 1)
+				return true
+			}
+		case diff < 0: // 消费者还没有读取上一轮的元素
+			return false
+		}
+		// 其它生产者已经抢占了这个位置，重试
+	}
+}
+
+// Poll removes and returns the oldest element, or returns false if the buffer is empty.
+// It must only be called by the consumer.
+func (b *WriteBuffer[T]) Poll() (T, bool) {
+	var zero T
+	head := b.head.Load()
+	slot := &b.slots[head&b.mask]
+	if slot.sequence.Load() != head+1 { // 空，或者生产者还没有写完
+		return zero, false
+	}
+	e := slot.value
+	slot.value = zero // 避免内存泄露
+	slot.sequence.Store(head + b.mask + 1)
+	b.head.Store(head + 1)
+	return e, true
+}
+
+// Drain polls every element and passes it to consume, and returns the number of elements.
+// It must only be called by the consumer.
+func (b *WriteBuffer[T]) Drain(consume func(T)) int {
+	n := 0
+	for e, ok := b.Poll(); ok; e, ok = b.Poll() {
+		consume(e)
+		n++
+	}
+	return n
+}
+
+// Size returns the approximate number of elements in the buffer.
+func (b *WriteBuffer[T]) Size() int {
+	head, tail := b.head.Load(), b.tail.Load()
+	if tail < head {
+		return 0
+	}
+	return int(tail - head)
+}
+
+// Capacity returns the maximum number of elements in the buffer.
+func (b *WriteBuffer[T]) Capacity() int {
+	return len(b.slots)
+}
@@ -0,0 +1,81 @@
+package caches_test
+
+import (
+	"gaffeine/caches"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestWriteBuffer(t *testing.T) {
+	b := caches.NewWriteBuffer[int](3)
+	assert.Equal(t, 4, b.Capacity())
+	_, ok := b.Poll()
+	assert.False(t, ok)
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, b.Offer(i))
+	}
+	assert.False(t, b.Offer(4)) // 满了，不丢弃，由调用者处理
+	assert.Equal(t, 4, b.Size())
+
+	e, ok := b.Poll()
+	assert.True(t, ok)
+	assert.Equal(t, 0, e)
+	assert.True(t, b.Offer(4))
+
+	var drained []int
+	assert.Equal(t, 4, b.Drain(func(e int) { drained = append(drained, e) }))
+	assert.Equal(t, []int{1, 2, 3, 4}, drained)
+	assert.Equal(t, 0, b.Size())
+}
+
+func TestWriteBuffer_concurrent(t *testing.T) {
+	const producers, perProducer = 8, 10_000
+	b := caches.NewWriteBuffer[[2]int](64)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				for !b.Offer([2]int{p, i}) { // 满了就等消费者
+					runtime.Gosched()
+				}
+			}
+		}(p)
+	}
+
+	next := make([]int, producers) // 每个生产者的元素按顺序到达
+	received := 0
+	for received < producers*perProducer {
+		n := b.Drain(func(e [2]int) {
+			assert.Equal(t, next[e[0]], e[1])
+			next[e[0]]++
+		})
+		if n == 0 {
+			runtime.Gosched()
+		}
+		received += n
+	}
+	wg.Wait()
+	assert.Equal(t, 0, b.Size())
+}
+
+func BenchmarkWriteBuffer_Offer(b *testing.B) {
+	buffer := caches.NewWriteBuffer[int](1024)
+	var mu sync.Mutex
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			for !buffer.Offer(i) {
+				if mu.TryLock() { // 满了由一个生产者负责清空，和Caffeine的维护方式相同
+					buffer.Drain(func(int) {})
+					mu.Unlock()
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+// Command gaffeine-sim replays a key trace against cache policies at several cache sizes and reports the hit ratios.
+//
+// Usage:
+//
+//	gaffeine-sim -trace keys.txt -policies tinylfu,lru,arc -sizes 100,1000,10000 -window 0.01 -output table
+//
+// The trace format is one of keys (one key per line, the default), lirs, arc, wikipedia, cachelib, twitter or record,
+// and gzip-compressed traces are decompressed on the fly. The output is a table, csv or json. Every policy runs at
+// the same capacity, except where a policy has a minimum size, which the output reports. -window sets the fraction of
+// the tinylfu cache given to its admission window, 0.02 by default.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gaffeine/caches"
+	"gaffeine/simulator"
+	"gaffeine/trace"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	tracePath := flag.String("trace", "", "path of the trace file")
+	format := flag.String("format", string(trace.KeysFormat), "trace format: keys, lirs, arc, wikipedia, cachelib, twitter or record")
+	policyList := flag.String("policies", "tinylfu,lru", "comma separated policies: tinylfu, lru, lfu, fifo, arc, s3fifo, sieve, lirs, clockpro")
+	sizeList := flag.String("sizes", "1000", "comma separated cache sizes")
+	output := flag.String("output", "table", "output format: table, csv or json")
+	window := flag.Float64("window", caches.DefaultWindow, "fraction of a tinylfu cache given to its admission window, in (0, 1)")
+	flag.Parse()
+
+	if err := run(*tracePath, trace.Format(*format), *policyList, *sizeList, *output, *window); err != nil {
+		fmt.Fprintln(os.Stderr, "gaffeine-sim:", err)
+		os.Exit(1)
+	}
+}
+
+func run(tracePath string, format trace.Format, policyList, sizeList, output string, window float64) error {
+	if tracePath == "" {
+		return fmt.Errorf("missing -trace")
+	}
+	if window <= 0 || window >= 1 {
+		return fmt.Errorf("invalid window %v", window)
+	}
+	policies := make([]caches.PolicyKind, 0)
+	for _, name := range strings.Split(policyList, ",") {
+		kind, err := caches.ParsePolicyKind(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		policies = append(policies, kind)
+	}
+	sizes := make([]int, 0)
+	for _, s := range strings.Split(sizeList, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid size %q", s)
+		}
+		sizes = append(sizes, size)
+	}
+	write := map[string]func(io.Writer, []simulator.Result) error{
+		"table": simulator.WriteTable,
+		"csv":   simulator.WriteCSV,
+		"json":  simulator.WriteJSON,
+	}[output]
+	if write == nil {
+		return fmt.Errorf("unknown output %q", output)
+	}
+
+	r, err := trace.Open(tracePath, format)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	results, err := simulator.SimulateOptions(r, policies, sizes, simulator.Options{WindowFraction: window})
+	if err != nil {
+		return err
+	}
+	return write(os.Stdout, results)
+}
@@ -0,0 +1,81 @@
+package frequncy_sketch_test
+
+import (
+	fs "gaffeine/frequncy_sketch"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// accuracy is the estimate error of a sketch measured against exact counts, capped at the sketch's maximum frequency.
+type accuracy struct {
+	meanAbsoluteError float64 // 平均绝对误差
+	overEstimated     float64 // 被高估的key的比例
+	underEstimated    int     // 被低估的key的个数，没有Reset时应该为0
+}
+
+// measureAccuracy feeds a seeded Zipfian stream into the sketch and compares every estimate with the exact count.
+func measureAccuracy(sketch *fs.FrequencySketch[int], events int, keys uint64) accuracy {
+	sketch.SampleSize = math.MaxInt32 // 关闭衰减，只测量碰撞带来的误差
+	zipf := rand.NewZipf(rand.New(rand.NewSource(7)), 1.01, 1, keys-1)
+	exact := make(map[int]int)
+	for i := 0; i < events; i++ {
+		key := int(zipf.Uint64())
+		exact[key]++
+		sketch.Increment(key)
+	}
+
+	var result accuracy
+	totalError, over := 0, 0
+	for key := 0; key < int(keys); key++ {
+		expected := exact[key]
+		if expected > sketch.MaxFrequency() {
+			expected = sketch.MaxFrequency()
+		}
+		estimated := sketch.Frequency(key)
+		if estimated > expected {
+			over++
+			totalError += estimated - expected
+		} else if estimated < expected {
+			result.underEstimated++
+			totalError += expected - estimated
+		}
+	}
+	result.meanAbsoluteError = float64(totalError) / float64(keys)
+	result.overEstimated = float64(over) / float64(keys)
+	return result
+}
+
+func TestAccuracy(t *testing.T) {
+	const maximumSize, events, keys = 512, 5_000, 2_000
+
+	builders := map[string]*fs.Builder[int]{
+		"default":              fs.NewBuilder[int](),
+		"conservative":         fs.NewBuilder[int]().ConservativeUpdate(true),
+		"depth1":               fs.NewBuilder[int]().Depth(1),
+		"depth2":               fs.NewBuilder[int]().Depth(2),
+		"depth8":               fs.NewBuilder[int]().Depth(8),
+		"depth8_conservative":  fs.NewBuilder[int]().Depth(8).ConservativeUpdate(true),
+		"wide":                 fs.NewBuilder[int]().CounterBits(fs.WideCounterBits),
+		"wide_conservative":    fs.NewBuilder[int]().CounterBits(fs.WideCounterBits).ConservativeUpdate(true),
+		"concurrent":           fs.NewBuilder[int]().Concurrent(true),
+		"concurrent_conserved": fs.NewBuilder[int]().Concurrent(true).ConservativeUpdate(true),
+	}
+	results := make(map[string]accuracy)
+	for name, builder := range builders {
+		result := measureAccuracy(builder.MaximumSize(maximumSize).Build(), events, keys)
+		results[name] = result
+		t.Logf("%-20s mean absolute error=%.4f over-estimated=%.2f%%", name, result.meanAbsoluteError, 100*result.overEstimated)
+
+		// Count-Min Sketch 只会高估，不会低估
+		assert.Equal(t, 0, result.underEstimated, name)
+	}
+
+	assert.Less(t, results["default"].meanAbsoluteError, results["depth1"].meanAbsoluteError)
+	assert.LessOrEqual(t, results["conservative"].meanAbsoluteError, results["default"].meanAbsoluteError)
+	assert.LessOrEqual(t, results["depth8_conservative"].meanAbsoluteError, results["depth8"].meanAbsoluteError)
+	assert.LessOrEqual(t, results["wide_conservative"].meanAbsoluteError, results["wide"].meanAbsoluteError)
+	assert.Equal(t, results["default"], results["concurrent"])
+	assert.Equal(t, results["conservative"], results["concurrent_conserved"])
+}
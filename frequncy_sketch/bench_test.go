@@ -0,0 +1,103 @@
+package frequncy_sketch_test
+
+import (
+	"fmt"
+	fs "gaffeine/frequncy_sketch"
+	"gaffeine/global"
+	"strconv"
+	"testing"
+)
+
+const benchKeys = 1 << 16 // 预先生成的key的数量，访问时循环使用
+
+// BenchmarkSketch compares the configurations of the sketch for int and string keys, serially and in parallel.
+// Run a part of it with e.g. go test ./frequncy_sketch -run xxx -bench 'Sketch/string/depth=4/bits=4'
+func BenchmarkSketch(b *testing.B) {
+	intKeys, stringKeys := make([]int, benchKeys), make([]string, benchKeys)
+	for i := range intKeys {
+		intKeys[i] = i * 7919
+		stringKeys[i] = "key:" + strconv.Itoa(i*7919)
+	}
+	for _, depth := range []int{4, 8} {
+		for _, counterBits := range []int{4, 8} {
+			for _, conservative := range []bool{false, true} {
+				name := fmt.Sprintf("depth=%d/bits=%d/conservative=%v", depth, counterBits, conservative)
+				b.Run("int/"+name, func(b *testing.B) {
+					benchmarkSketch(b, intKeys, depth, counterBits, conservative)
+				})
+				b.Run("string/"+name, func(b *testing.B) {
+					benchmarkSketch(b, stringKeys, depth, counterBits, conservative)
+				})
+			}
+		}
+	}
+}
+
+func benchmarkSketch[K global.Key](b *testing.B, keys []K, depth, counterBits int, conservative bool) {
+	newSketch := func(concurrent bool) *fs.FrequencySketch[K] {
+		return fs.NewBuilder[K]().MaximumSize(benchKeys / 4).Depth(depth).CounterBits(counterBits).
+			ConservativeUpdate(conservative).Concurrent(concurrent).Build()
+	}
+	b.Run("increment/serial", func(b *testing.B) {
+		sketch := newSketch(false)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sketch.Increment(keys[i&(benchKeys-1)])
+		}
+	})
+	b.Run("frequency/serial", func(b *testing.B) {
+		sketch := newSketch(false)
+		for _, key := range keys {
+			sketch.Increment(key)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sketch.Frequency(keys[i&(benchKeys-1)])
+		}
+	})
+	b.Run("increment/parallel", func(b *testing.B) {
+		sketch := newSketch(true)
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				sketch.Increment(keys[i&(benchKeys-1)])
+			}
+		})
+	})
+	b.Run("frequency/parallel", func(b *testing.B) {
+		sketch := newSketch(true)
+		for _, key := range keys {
+			sketch.Increment(key)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				sketch.Frequency(keys[i&(benchKeys-1)])
+			}
+		})
+	})
+}
+
+// BenchmarkSketch_heavyHitters measures concurrent increments of a skewed stream while the 16 hottest keys are tracked.
+func BenchmarkSketch_heavyHitters(b *testing.B) {
+	keys := make([]int, benchKeys)
+	for i := range keys {
+		keys[i] = i * i % 1024 // 少数key很热，大部分key很冷
+	}
+	for _, track := range []int{0, 16} {
+		b.Run(fmt.Sprintf("track=%d", track), func(b *testing.B) {
+			sketch := fs.NewBuilder[int]().MaximumSize(benchKeys / 4).Concurrent(true).Build().TrackHeavyHitters(track)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					sketch.Increment(keys[i&(benchKeys-1)])
+				}
+			})
+		})
+	}
+}
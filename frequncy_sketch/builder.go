@@ -0,0 +1,80 @@
+package frequncy_sketch
+
+import (
+	"fmt"
+	"gaffeine/global"
+)
+
+// NewBuilder returns a builder of FrequencySketch, whose defaults are the same as New:
+// a depth of four, 4-bit counters, regular updates and no support for concurrent callers.
+func NewBuilder[K global.Key]() *Builder[K] {
+	return &Builder[K]{
+		depth:       DefaultDepth,
+		counterBits: DefaultCounterBits,
+	}
+}
+
+type Builder[K global.Key] struct {
+	maximumSize  int  // 最大cache的数量，大于0时Build会调用EnsureCapacity
+	depth        int  // 每个元素对应的计数器个数
+	counterBits  int  // 每个计数器的位数
+	conservative bool // 是否使用保守更新
+	concurrent   bool // 是否允许并发调用
+	heavyHitters int  // 大于0时，统计最热的heavyHitters个key
+}
+
+// MaximumSize sets the maximum size of the caches, the built sketch is then already sized by EnsureCapacity.
+func (b *Builder[K]) MaximumSize(size int) *Builder[K] {
+	b.maximumSize = size
+	return b
+}
+
+// Depth sets the number of counters of each element, which must be 1, 2, 4 or 8.
+// A larger depth lowers the chance of over-estimation, at the cost of touching more counters per operation.
+func (b *Builder[K]) Depth(depth int) *Builder[K] {
+	b.depth = depth
+	return b
+}
+
+// CounterBits sets the width of each counter, which must be 4 (saturates at 15) or 8 (saturates at 255).
+func (b *Builder[K]) CounterBits(bits int) *Builder[K] {
+	b.counterBits = bits
+	return b
+}
+
+// ConservativeUpdate enables the conservative update, which only increments the counters that equal the current minimum.
+func (b *Builder[K]) ConservativeUpdate(enabled bool) *Builder[K] {
+	b.conservative = enabled
+	return b
+}
+
+// Concurrent makes the sketch safe for concurrent callers, see NewConcurrent.
+func (b *Builder[K]) Concurrent(enabled bool) *Builder[K] {
+	b.concurrent = enabled
+	return b
+}
+
+// HeavyHitters makes the sketch track the k keys with the highest estimated counts, see TrackHeavyHitters.
+func (b *Builder[K]) HeavyHitters(k int) *Builder[K] {
+	b.heavyHitters = k
+	return b
+}
+
+// Build returns a new FrequencySketch. It panics if the depth or the counter width is not supported.
+func (b *Builder[K]) Build() *FrequencySketch[K] {
+	if b.depth != 1 && b.depth != 2 && b.depth != 4 && b.depth != 8 {
+		panic(fmt.Sprintf("not support depth %d, it must be 1, 2, 4 or 8", b.depth))
+	}
+	if b.counterBits != DefaultCounterBits && b.counterBits != WideCounterBits {
+		panic(fmt.Sprintf("not support counter bits %d, it must be 4 or 8", b.counterBits))
+	}
+
+	sketch := New[K]().configure(b.depth, b.counterBits)
+	sketch.conservative = b.conservative
+	sketch.concurrent = b.concurrent
+	sketch.TrackHeavyHitters(b.heavyHitters)
+	if b.maximumSize > 0 {
+		sketch.EnsureCapacity(b.maximumSize)
+	}
+	return sketch
+}
@@ -0,0 +1,85 @@
+package frequncy_sketch_test
+
+import (
+	fs "gaffeine/frequncy_sketch"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestBuilder_default(t *testing.T) {
+	sketch := fs.NewBuilder[int]().MaximumSize(512).Build()
+	assert.Equal(t, fs.DefaultDepth, sketch.Depth())
+	assert.Equal(t, 15, sketch.MaxFrequency())
+	assert.False(t, sketch.IsConcurrent())
+	assert.Equal(t, 512, len(sketch.Table))
+	assert.Equal(t, 5120, sketch.SampleSize)
+}
+
+func TestBuilder_invalid(t *testing.T) {
+	assert.Panics(t, func() { fs.NewBuilder[int]().Depth(3).Build() })
+	assert.Panics(t, func() { fs.NewBuilder[int]().Depth(16).Build() })
+	assert.Panics(t, func() { fs.NewBuilder[int]().CounterBits(16).Build() })
+}
+
+func TestBuilder_wideCounters(t *testing.T) {
+	sketch := fs.NewBuilder[int]().MaximumSize(512).CounterBits(fs.WideCounterBits).Build()
+	assert.Equal(t, 255, sketch.MaxFrequency())
+	assert.Equal(t, 1024, len(sketch.Table)) // 8位计数器，table的长度翻倍
+	assert.Equal(t, 127, sketch.BlockMask)
+
+	for i := 0; i < 300; i++ {
+		sketch.Increment(item)
+	}
+	assert.Equal(t, 255, sketch.Frequency(item))
+	assert.Equal(t, 0, sketch.Frequency(item+1))
+
+	sketch.Reset()
+	assert.Equal(t, 127, sketch.Frequency(item))
+}
+
+func TestBuilder_wideCountersFull(t *testing.T) {
+	sketch := fs.NewBuilder[int]().MaximumSize(64).CounterBits(fs.WideCounterBits).Build()
+	for i := range sketch.Table {
+		sketch.Table[i] = -1
+	}
+	sketch.Reset()
+	for _, item := range sketch.Table {
+		assert.Equal(t, fs.WideResetMask, item)
+	}
+}
+
+func TestBuilder_depth(t *testing.T) {
+	for _, depth := range []int{1, 2, 4, 8} {
+		sketch := fs.NewBuilder[int]().MaximumSize(512).Depth(depth).Build()
+		sketch.SampleSize = math.MaxInt32
+		for i := 0; i < 20; i++ {
+			sketch.Increment(item)
+		}
+		sketch.Increment(item + 1)
+		assert.Equal(t, depth, sketch.Depth())
+		assert.Equal(t, 15, sketch.Frequency(item), "depth=%d", depth)
+		assert.Equal(t, 1, sketch.Frequency(item+1), "depth=%d", depth)
+		assert.Equal(t, 0, sketch.Frequency(item+2), "depth=%d", depth)
+	}
+}
+
+func TestBuilder_conservativeUpdate(t *testing.T) {
+	sketch := fs.NewBuilder[int]().MaximumSize(512).ConservativeUpdate(true).Build()
+	sketch.Increment(item)
+	sketch.Increment(item)
+	assert.Equal(t, 2, sketch.Frequency(item))
+
+	// 保守更新时，所有计数器都达到最大值后，不再增加
+	for i := 0; i < 20; i++ {
+		sketch.Increment(item)
+	}
+	assert.Equal(t, 15, sketch.Frequency(item))
+}
+
+func TestBuilder_concurrent(t *testing.T) {
+	sketch := fs.NewBuilder[string]().MaximumSize(512).Concurrent(true).Build()
+	assert.True(t, sketch.IsConcurrent())
+	sketch.Increment("key")
+	assert.Equal(t, 1, sketch.Frequency("key"))
+}
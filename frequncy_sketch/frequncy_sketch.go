@@ -1,15 +1,27 @@
 package frequncy_sketch
 
 import (
+	"errors"
+	"fmt"
 	"gaffeine/global"
 	"gaffeine/utils"
 	"math"
 	"math/bits"
+	"strconv"
+	"sync/atomic"
+	"unsafe"
 )
 
 const (
 	ResetMask = int64(0x7777777777777777) // uint64类型
 	OneMask   = int64(0x1111111111111111) // uint64类型
+
+	WideResetMask = int64(0x7f7f7f7f7f7f7f7f) // 8位计数器使用的ResetMask
+	WideOneMask   = int64(0x0101010101010101) // 8位计数器使用的OneMask
+
+	DefaultDepth       = 4 // 默认每个元素对应4个计数器
+	DefaultCounterBits = 4 // 默认每个计数器4位，最大值15
+	WideCounterBits    = 8 // 8位计数器，最大值255
 )
 
 // FrequencySketch maintains a 4-bit CountMinSketch [1] with periodic aging to provide the popularity history for the TinyLfu admission policy [2].
@@ -50,6 +62,9 @@ const (
 // The O(n) cost of aging is amortized, ideal for hardware prefetching, and uses inexpensive bit manipulations per array location.
 // 衰减的 O(n) 成本是摊销的，非常适合硬件预取，并对每个数组位置使用廉价的位操作。
 //
+// The depth (1, 2, 4 or 8), the counter width (4 or 8 bits) and conservative update can be selected with Builder.
+// 深度（1、2、4、8）、计数器位数（4或8位）以及保守更新可以通过 Builder 进行选择。
+//
 // [1] An Improved Data Stream Summary: The Count-Min Sketch and its Applications
 // [1] 改进的数据流摘要：Count-Min Sketch 及其应用
 // http://dimacs.rutgers.edu/~graham/pubs/papers/cm-full.pdf
@@ -67,6 +82,22 @@ type FrequencySketch[K global.Key] struct {
 	BlockMask  int // 一个块(8个int64大小）的掩码
 	Size       int // 当前已经使用的计数器个数，这个是一个评估值，不是一个精确值
 	Table      []int64
+
+	depth        int  // 每个元素对应的计数器个数，只能是1、2、4、8
+	counterBits  int  // 每个计数器的位数，只能是4或8
+	conservative bool // 是否使用保守更新：只增加等于当前最小值的计数器
+
+	// 以下由depth和counterBits推导而来，预先计算以减少Increment和Frequency的开销
+	segmentShift uint // 一个块分成depth段，每段有 1<<segmentShift 个long
+	segmentMask  int  // 段内long的下标掩码
+	counterShift uint // j<<counterShift 是第j个计数器在long中的位置：4位计数器是2，8位计数器是3
+	indexMask    int  // 一个long中计数器下标的掩码：4位计数器是15，8位计数器是7
+	counterMask  int  // 计数器的最大值：4位计数器是15，8位计数器是255
+
+	concurrent bool  // 是否允许多个goroutine同时调用Increment、Frequency和Reset
+	resetting  int32 // 并发模式下，标记是否有goroutine正在执行Reset
+
+	heavyHitters *HeavyHitters[K] // 不为nil时，Increment会把估算值提供给heavyHitters，用于统计最热的K个key
 }
 
 func New[K global.Key]() *FrequencySketch[K] {
@@ -76,12 +107,69 @@ func New[K global.Key]() *FrequencySketch[K] {
 		BlockMask:  0,
 		Size:       0,
 	}
-	return &sketch
+	return sketch.configure(DefaultDepth, DefaultCounterBits)
+}
+
+// configure sets the depth and the counter width and derives the shifts and masks from them.
+func (f *FrequencySketch[K]) configure(depth, counterBits int) *FrequencySketch[K] {
+	f.depth = depth
+	f.counterBits = counterBits
+	f.segmentShift = uint(3 - bits.TrailingZeros(uint(depth)))
+	f.segmentMask = 1<<f.segmentShift - 1
+	f.counterShift = uint(bits.TrailingZeros(uint(counterBits)))
+	f.indexMask = 64>>f.counterShift - 1
+	f.counterMask = 1<<counterBits - 1
+	return f
+}
+
+// NewConcurrent returns a sketch that may be shared by concurrent callers of Increment, Frequency and Reset.
+// Counters are updated with a CAS loop on Table and Size is maintained atomically, so, as in the
+// sequential sketch, Size remains an estimate. EnsureCapacity must not race with other methods.
+func NewConcurrent[K global.Key]() *FrequencySketch[K] {
+	sketch := New[K]()
+	sketch.concurrent = true
+	return sketch
+}
+
+// IsConcurrent reports whether the sketch was created by NewConcurrent.
+func (f *FrequencySketch[K]) IsConcurrent() bool {
+	return f.concurrent
+}
+
+// TrackHeavyHitters starts tracking the k keys with the highest estimated counts, see HeavyHitters.
+// Tracking costs a Frequency lookup and a heap update on every Increment. A k of zero stops tracking.
+func (f *FrequencySketch[K]) TrackHeavyHitters(k int) *FrequencySketch[K] {
+	if k <= 0 {
+		f.heavyHitters = nil
+	} else {
+		f.heavyHitters = NewHeavyHitters[K](k)
+	}
+	return f
+}
+
+// HeavyHitters returns the hottest tracked keys with their estimated counts, ordered from the hottest,
+// or nil if the sketch does not track heavy hitters.
+func (f *FrequencySketch[K]) HeavyHitters() []HeavyHitter[K] {
+	if f.heavyHitters == nil {
+		return nil
+	}
+	return f.heavyHitters.TopK()
+}
+
+// Depth returns the number of counters used for each element.
+func (f *FrequencySketch[K]) Depth() int {
+	return f.depth
+}
+
+// MaxFrequency returns the saturation cap of a counter: 15 for 4-bit counters and 255 for 8-bit counters.
+func (f *FrequencySketch[K]) MaxFrequency() int {
+	return f.counterMask
 }
 
 // EnsureCapacity Initializes and increases the capacity of this <tt>FrequencySketch</tt> instance, if necessary,
 // to ensure that it can accurately estimate the popularity of elements given the maximum size of
 // the caches. This operation forgets all previous counts when resizing.
+// With 8-bit counters the table is twice as long, so that the width of the sketch stays the same.
 // @param maximumSize the maximum size of the caches
 func (f *FrequencySketch[K]) EnsureCapacity(maximumSize int) *FrequencySketch[K] {
 	if maximumSize <= 0 {
@@ -89,11 +177,12 @@ func (f *FrequencySketch[K]) EnsureCapacity(maximumSize int) *FrequencySketch[K]
 	}
 
 	maximum := int(utils.Min(maximumSize, math.MaxInt32>>1))
-	if f.Table != nil && len(f.Table) >= maximum {
+	widen := f.counterBits / DefaultCounterBits // 一个long中8位计数器的个数只有4位计数器的一半
+	if f.Table != nil && len(f.Table) >= maximum*widen {
 		return f
 	}
 	newSize := int(utils.Max(utils.CeilingPowerOfTwo32(maximum), 8))
-	f.Table = make([]int64, newSize)
+	f.Table = make([]int64, newSize*widen)
 	if maximumSize == 0 {
 		f.SampleSize = 10
 	} else {
@@ -117,62 +206,84 @@ func (f *FrequencySketch[K]) EnsureCapacity(maximumSize int) *FrequencySketch[K]
 	return f
 }
 
-// Increment Increments the popularity of the element if it does not exceed the maximum (15). The popularity
-// of all elements will be periodically down sampled when the observed events exceed a threshold.
+// Increment Increments the popularity of the element if it does not exceed the maximum (15, or 255 with 8-bit counters).
+// The popularity of all elements will be periodically down sampled when the observed events exceed a threshold.
 // This process provides a frequency aging to allow expired long term entries to fade away.
+// With conservative update only the counters equal to the current minimum are incremented,
+// which reduces the over-estimation caused by hash collisions.
 // @param e the element to add
 func (f *FrequencySketch[K]) Increment(key K) *FrequencySketch[K] {
-	// 4、5、6、7存放的是table的index
-	// 0、1、2、3存放的是table[index]的计数器的offset
-	// 注意：table[index]是一个long，所以有64/4=16个计数器
-	index := make([]int, 8)
-	blockHash := f.spread(hashcode(key))
+	blockHash := Hash(key)
 	counterHash := f.rehash(blockHash)
 	block := int(blockHash&uint32(f.BlockMask)) << 3 // 找到table的位置，table的一个块有8个uint64，所以要<<3
 
-	for i := 0; i < 4; i++ {
-		h := int(counterHash >> (i << 3))      // i<<3 在循环中，分别是：0、8、16、24
-		index[i] = (h >> 1) & 15               // 执行>>1，是为了提高hash的分散性；&15 是把结果控制在0-15之间
-		offset := h & 1                        // offset 结果只能是0或者1，换句话说，h & 1 相当于 h % 2的结果，也就是 offset 代表h是奇数还是偶数
-		index[i+4] = block + offset + (i << 1) // block是table的下标；offset的结果只能是0或者1；i << 1 只能是0、2、4、6；所以，最后的值：block + 0/1 + 0/2/4/6
-	}
-	added := f.incrementAt(index[4], index[0])
-	added = f.incrementAt(index[5], index[1]) || added
-	added = f.incrementAt(index[6], index[2]) || added
-	added = f.incrementAt(index[7], index[3]) || added
-
-	if added {
-		f.Size += 1
-		if f.Size == f.SampleSize {
-			f.Reset()
+	added := false
+	if f.conservative {
+		minimum := f.counterMask
+		for i := 0; i < f.depth; i++ {
+			if count := f.counterAt(f.indexOf(block, counterHash, i)); count < minimum {
+				minimum = count
+			}
+		}
+		for i := 0; i < f.depth; i++ {
+			if word, counter := f.indexOf(block, counterHash, i); f.counterAt(word, counter) == minimum {
+				added = f.incrementAt(word, counter) || added
+			}
+		}
+	} else {
+		for i := 0; i < f.depth; i++ {
+			added = f.incrementAt(f.indexOf(block, counterHash, i)) || added
 		}
 	}
+
+	if f.heavyHitters != nil {
+		f.heavyHitters.Offer(key, f.Frequency(key))
+	}
+	if added && f.addSize(1) >= f.SampleSize {
+		f.tryReset()
+	}
 	return f
 }
 
-// Frequency Returns the estimated number of occurrences of an element, up to the maximum (15).
+// Frequency Returns the estimated number of occurrences of an element, up to the maximum (15, or 255 with 8-bit counters).
 // @param e the element to count occurrences of
 // @return the estimated number of occurrences of the element; possibly zero but never negative
 func (f *FrequencySketch[K]) Frequency(key K) int {
-	count := make([]int, 4)
-	blockHash := f.spread(hashcode(key))
+	blockHash := Hash(key)
 	counterHash := f.rehash(blockHash)
 	block := int(blockHash&uint32(f.BlockMask)) << 3
 
-	for i := 0; i < 4; i++ {
-		h := int(counterHash >> (i << 3)) // i<<3 在循环中，分别是：0、8、16、24
-		index := (h >> 1) & 15            // 执行>>1，是为了提高hash的分散性；&15 是把结果控制在0-15之间
-		offset := h & 1                   // offset 结果只能是0或者1，换句话说，h & 1 相当于 h % 2的结果，也就是 offset 代表h是奇数还是偶数
-		tableV := uint64(f.Table[block+offset+(i<<1)])
-		count[i] = int(tableV >> (index << 2) & uint64(0xf))
+	frequency := f.counterMask
+	for i := 0; i < f.depth; i++ {
+		if count := f.counterAt(f.indexOf(block, counterHash, i)); count < frequency { // 直接取最小值，避免分配切片
+			frequency = count
+		}
 	}
+	return frequency
+}
 
-	return int(utils.Min(utils.Min(count[0], count[1]), utils.Min(count[2], count[3])))
+// indexOf finds the i-th counter of an element: word is the table index and counter is the counter in table[word].
+// Every counter is selected from a distinct segment of the 64-byte block, so with the default depth of four
+// each counter comes from its own 16-byte segment.
+func (f *FrequencySketch[K]) indexOf(block int, counterHash uint32, i int) (word, counter int) {
+	if i >= 4 { // 32位的hash只够4个计数器使用，depth=8时，后4个计数器再hash一次
+		counterHash = f.rehash(counterHash)
+	}
+	// 一个块有8个long，分成depth段，每段有 1<<segmentShift 个long。depth=4时，segmentShift=1，每段2个long
+	h := int(counterHash >> ((i & 3) << 3))                // (i&3)<<3 分别是：0、8、16、24
+	counter = (h >> f.segmentShift) & f.indexMask          // 执行>>segmentShift，是为了提高hash的分散性；再把结果控制在一个long的计数器个数之内（4位计数器是0-15）
+	word = block + h&f.segmentMask + (i << f.segmentShift) // depth=4时：block + 0/1 + 0/2/4/6
+	return word, counter
+}
+
+// counterAt returns the value of the j-th counter of table[i].
+func (f *FrequencySketch[K]) counterAt(i, j int) int {
+	return int(uint64(f.load(i)) >> ((j << f.counterShift) & 63) & uint64(f.counterMask))
 }
 
 // spread Applies a supplemental hash function to defend against a poor quality hash.
 // https://github.com/skeeto/hash-prospector#three-round-functions
-func (f *FrequencySketch[K]) spread(x uint32) uint32 {
+func spread(x uint32) uint32 {
 	x ^= x >> 17
 	x *= 0xed5ad4bb
 	x ^= x >> 11
@@ -189,7 +300,7 @@ func (f *FrequencySketch[K]) rehash(x uint32) uint32 {
 	return x
 }
 
-// incrementAt Increments the specified counter by 1 if it is not already at the maximum value (15).
+// incrementAt Increments the specified counter by 1 if it is not already at the maximum value (15, or 255 with 8-bit counters).
 // @param i the table index (16 counters if table[i])
 // @param j the counter to increment
 // @return if incremented
@@ -201,11 +312,24 @@ func (f *FrequencySketch[K]) incrementAt(i, j int) bool {
 	//		j=1，那么offset=4，表示4-7；
 	//		j=2，那么offset=8，表示8-11；
 	//  	...... 以此类推
-	offset := j << 2
+	// 8位计数器时，相当于j*8，offset的结果是[0, 56]
+	offset := (j << f.counterShift) & 63
 
 	// 0xfL 表示一个值为 1111（4 个二进制 1）的 long 类型常量，也就是一个 4-bit 的掩码。
 	// 0xfL << offset 将这个 4-bit 掩码移到相应的位置上，对应到 long 值中某个 4-bit 计数器的位置。
-	mask := int64(0xf) << offset
+	mask := int64(f.counterMask) << offset
+
+	if f.concurrent {
+		for { // CAS失败说明其他goroutine修改了同一个long，重新读取后再试
+			old := atomic.LoadInt64(&f.Table[i])
+			if (old & mask) == mask {
+				return false
+			}
+			if atomic.CompareAndSwapInt64(&f.Table[i], old, old+int64(1)<<offset) {
+				return true
+			}
+		}
+	}
 
 	if (f.Table[i] & mask) != mask {
 		// 判断是否已经达到最大数15
@@ -215,19 +339,137 @@ func (f *FrequencySketch[K]) incrementAt(i, j int) bool {
 	return false
 }
 
+// load reads table[i], atomically if the sketch is concurrent.
+func (f *FrequencySketch[K]) load(i int) int64 {
+	if f.concurrent {
+		return atomic.LoadInt64(&f.Table[i])
+	}
+	return f.Table[i]
+}
+
+// addSize adds delta to Size, atomically if the sketch is concurrent, and returns the new value.
+func (f *FrequencySketch[K]) addSize(delta int) int {
+	if !f.concurrent {
+		f.Size += delta
+		return f.Size
+	}
+	if strconv.IntSize == 64 {
+		return int(atomic.AddInt64((*int64)(unsafe.Pointer(&f.Size)), int64(delta)))
+	}
+	return int(atomic.AddInt32((*int32)(unsafe.Pointer(&f.Size)), int32(delta)))
+}
+
+// storeSize sets Size, atomically if the sketch is concurrent.
+func (f *FrequencySketch[K]) storeSize(size int) {
+	if !f.concurrent {
+		f.Size = size
+	} else if strconv.IntSize == 64 {
+		atomic.StoreInt64((*int64)(unsafe.Pointer(&f.Size)), int64(size))
+	} else {
+		atomic.StoreInt32((*int32)(unsafe.Pointer(&f.Size)), int32(size))
+	}
+}
+
+// tryReset ages the sketch unless another goroutine is already doing so.
+func (f *FrequencySketch[K]) tryReset() {
+	if !f.concurrent {
+		f.Reset()
+		return
+	}
+	if atomic.CompareAndSwapInt32(&f.resetting, 0, 1) {
+		f.Reset()
+		atomic.StoreInt32(&f.resetting, 0)
+	}
+}
+
 // Reset reduces every counter by half of its original value.
+// On a concurrent sketch each slot is halved with a CAS loop, so increments racing with Reset are
+// either applied before the slot is halved or after it, but never lost half-way.
 func (f *FrequencySketch[K]) Reset() *FrequencySketch[K] {
+	resetMask, oneMask := ResetMask, OneMask
+	if f.counterBits == WideCounterBits {
+		resetMask, oneMask = WideResetMask, WideOneMask
+	}
+
 	// count: 表示有多少个有效计数器。
 	count := 0
+	if f.concurrent {
+		for i := 0; i < len(f.Table); i++ {
+			for {
+				old := atomic.LoadInt64(&f.Table[i])
+				if atomic.CompareAndSwapInt64(&f.Table[i], old, int64(uint64(old)>>1)&resetMask) {
+					count += bits.OnesCount64(uint64(old & oneMask))
+					break
+				}
+			}
+		}
+		f.storeSize((f.addSize(0) - count/f.depth) >> 1)
+		if f.heavyHitters != nil {
+			f.heavyHitters.halve()
+		}
+		return f
+	}
 	for i := 0; i < len(f.Table); i++ {
 		// 只能统计奇数的计算器，所以，count不是精确值，而是估算值
 		// 为什么要用估算，而不用精确算法。是为了性能和效率。
-		count += bits.OnesCount64(uint64(f.Table[i] & OneMask))
+		count += bits.OnesCount64(uint64(f.Table[i] & oneMask))
 
 		// >>>1 相当于除以2，但是注意：1111，1111 执行后，结果为：0111，1111；可以发现第2个计数器仍然是1111，
 		// 所以，还需要 & ResetMask，将第2个计数器的高位设置为0，这样 0111，1111 变成了 0111, 0111
-		f.Table[i] = int64(uint64(f.Table[i])>>1) & ResetMask
+		f.Table[i] = int64(uint64(f.Table[i])>>1) & resetMask
+	}
+	// 每个元素增加depth个计数器，所以奇数计数器个数除以depth（默认是4，即>>2）
+	f.Size = (f.Size - count/f.depth) >> 1
+	if f.heavyHitters != nil {
+		f.heavyHitters.halve()
 	}
-	f.Size = (f.Size - (count >> 2)) >> 1
 	return f
 }
+
+// ErrIncompatibleSketch is returned by Merge when the two sketches do not have the same dimensions.
+var ErrIncompatibleSketch = errors.New("frequncy_sketch: incompatible sketch")
+
+// Merge adds the counters of other to the counters of f, so that f estimates the popularity of the elements
+// seen by both sketches, e.g. to aggregate the popularity history of many replicas.
+// Counters saturate at the maximum (15, or 255 with 8-bit counters) instead of overflowing into their neighbours.
+// The sizes are added as well, and f is aged by Reset if the sum reaches its SampleSize.
+// Both sketches must have the same table length, depth and counter width, otherwise ErrIncompatibleSketch
+// is returned and f is left unchanged. Merge must not race with other methods of f.
+func (f *FrequencySketch[K]) Merge(other *FrequencySketch[K]) error {
+	if len(f.Table) != len(other.Table) || f.depth != other.depth || f.counterBits != other.counterBits {
+		return fmt.Errorf("%w: table length %d/%d, depth %d/%d, counter bits %d/%d", ErrIncompatibleSketch,
+			len(f.Table), len(other.Table), f.depth, other.depth, f.counterBits, other.counterBits)
+	}
+
+	counters := 64 >> f.counterShift // 一个long中计数器的个数
+	for i := range f.Table {
+		a, b := uint64(f.load(i)), uint64(other.load(i))
+		if b == 0 {
+			continue
+		}
+		merged := uint64(0)
+		for j := 0; j < counters; j++ {
+			offset := uint(j) << f.counterShift
+			sum := (a>>offset)&uint64(f.counterMask) + (b>>offset)&uint64(f.counterMask)
+			if sum > uint64(f.counterMask) { // 饱和加法：超过最大值时，取最大值
+				sum = uint64(f.counterMask)
+			}
+			merged |= sum << offset
+		}
+		f.store(i, int64(merged))
+	}
+
+	if f.addSize(other.addSize(0)) >= f.SampleSize {
+		f.Reset()
+	}
+	return nil
+}
+
+// store writes table[i], atomically if the sketch is concurrent.
+func (f *FrequencySketch[K]) store(i int, v int64) {
+	if f.concurrent {
+		atomic.StoreInt64(&f.Table[i], v)
+	} else {
+		f.Table[i] = v
+	}
+}
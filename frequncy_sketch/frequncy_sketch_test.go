@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"math"
 	"math/bits"
+	"sync"
 	"testing"
 )
 
@@ -159,3 +160,137 @@ func TestHeavyHitters(t *testing.T) {
 		}
 	}
 }
+
+func TestIncrement_noAllocs(t *testing.T) {
+	sketch := makeSketch(512)
+	allocs := testing.AllocsPerRun(1000, func() { sketch.Increment(item) })
+	assert.Equal(t, float64(0), allocs)
+
+	strSketch := fs.New[string]().EnsureCapacity(512)
+	allocs = testing.AllocsPerRun(1000, func() { strSketch.Increment("key") })
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestFrequency_noAllocs(t *testing.T) {
+	sketch := makeSketch(512)
+	sketch.Increment(item)
+	allocs := testing.AllocsPerRun(1000, func() { sketch.Frequency(item) })
+	assert.Equal(t, float64(0), allocs)
+
+	strSketch := fs.New[string]().EnsureCapacity(512)
+	allocs = testing.AllocsPerRun(1000, func() { strSketch.Frequency("key") })
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestConcurrent_noAllocs(t *testing.T) {
+	sketch := fs.NewConcurrent[int]().EnsureCapacity(512)
+	assert.True(t, sketch.IsConcurrent())
+	allocs := testing.AllocsPerRun(1000, func() {
+		sketch.Increment(item)
+		sketch.Frequency(item)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestConcurrent_increment(t *testing.T) {
+	sketch := fs.NewConcurrent[int]().EnsureCapacity(512)
+	sketch.SampleSize = math.MaxInt32
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 4; i++ {
+				sketch.Increment(item)
+			}
+		}()
+	}
+	wg.Wait()
+	// 8个goroutine每个增加4次，计数器达到上限15，不能溢出到相邻的计数器
+	assert.Equal(t, 15, sketch.Frequency(item))
+	assert.Equal(t, 0, sketch.Frequency(item+1))
+}
+
+func TestConcurrent_reset(t *testing.T) {
+	sketch := fs.NewConcurrent[int]().EnsureCapacity(64)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10*sketch.SampleSize; i++ {
+				sketch.Increment(g*1_000_000 + i)
+				sketch.Frequency(i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Less(t, sketch.Size, sketch.SampleSize)
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, sketch.Frequency(i), 15)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	sketch, other := makeSketch(512), makeSketch(512)
+	for i := 0; i < 3; i++ {
+		sketch.Increment(item)
+	}
+	for i := 0; i < 5; i++ {
+		other.Increment(item)
+	}
+	other.Increment(item + 1)
+
+	assert.Nil(t, sketch.Merge(other))
+	assert.Equal(t, 8, sketch.Frequency(item))
+	assert.Equal(t, 1, sketch.Frequency(item+1))
+	assert.Equal(t, 0, sketch.Frequency(item+2))
+	assert.Equal(t, 9, sketch.Size)
+
+	// other 不变
+	assert.Equal(t, 5, other.Frequency(item))
+}
+
+func TestMerge_saturate(t *testing.T) {
+	sketch, other := makeSketch(512), makeSketch(512)
+	for i := 0; i < 10; i++ {
+		sketch.Increment(item)
+		other.Increment(item)
+	}
+	other.Increment(item + 1)
+
+	assert.Nil(t, sketch.Merge(other))
+	assert.Equal(t, 15, sketch.Frequency(item))
+	assert.Equal(t, 1, sketch.Frequency(item+1))
+
+	for i := range sketch.Table {
+		sketch.Table[i], other.Table[i] = -1, -1
+	}
+	assert.Nil(t, sketch.Merge(other))
+	for _, v := range sketch.Table {
+		assert.Equal(t, int64(-1), v) // 计数器不会溢出到相邻的计数器
+	}
+}
+
+func TestMerge_reset(t *testing.T) {
+	sketch, other := makeSketch(64), makeSketch(64)
+	sketch.Size = sketch.SampleSize - 1
+	other.Increment(item)
+	other.Increment(item)
+
+	assert.Nil(t, sketch.Merge(other))
+	assert.Equal(t, 1, sketch.Frequency(item))
+	assert.Less(t, sketch.Size, sketch.SampleSize)
+}
+
+func TestMerge_incompatible(t *testing.T) {
+	sketch := makeSketch(512)
+	sketch.Increment(item)
+
+	assert.ErrorIs(t, sketch.Merge(makeSketch(1024)), fs.ErrIncompatibleSketch)
+	assert.ErrorIs(t, sketch.Merge(fs.NewBuilder[int]().MaximumSize(512).Depth(8).Build()), fs.ErrIncompatibleSketch)
+	assert.ErrorIs(t, sketch.Merge(fs.NewBuilder[int]().MaximumSize(256).CounterBits(fs.WideCounterBits).Build()), fs.ErrIncompatibleSketch)
+	assert.Equal(t, 1, sketch.Frequency(item))
+}
@@ -5,6 +5,12 @@ import (
 	"math"
 )
 
+// Hash returns the hash of key used by the sketch. The sketch selects the block of a key by the low bits of the hash,
+// so callers partitioning keys consistently with the sketch, e.g. caches.ShardedCache, should use the high bits.
+func Hash[T global.Key](key T) uint32 {
+	return spread(hashcode(key))
+}
+
 func hashcode[T global.Key](v T) uint32 {
 	switch x := any(v).(type) {
 	case int:
@@ -0,0 +1,141 @@
+package frequncy_sketch
+
+import (
+	"container/heap"
+	"gaffeine/global"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// HeavyHitter is a tracked key with its estimated count.
+type HeavyHitter[K global.Key] struct {
+	Key   K
+	Count int
+}
+
+// HeavyHitters tracks the K keys with the highest estimated counts, the "top-K heavy hitters" of a stream.
+// It keeps a min-heap of at most k keys fed by the sketch's estimates during Increment:
+// a new key replaces the coldest tracked key only if its estimate is higher.
+// It is safe for concurrent use. Offer only takes the lock for the estimates above the count of the coldest tracked
+// key, so most increments of a skewed stream do not contend.
+type HeavyHitters[K global.Key] struct {
+	mu        sync.Mutex
+	k         int
+	items     hitterHeap[K]
+	index     map[K]*hitterItem[K] // 快速找到key在堆中的位置
+	threshold atomic.Int64         // 堆满时是堆顶的计数，否则是0；不大于它的估算值不会改变堆
+}
+
+type hitterItem[K global.Key] struct {
+	HeavyHitter[K]
+	pos int // 在堆中的下标
+}
+
+func NewHeavyHitters[K global.Key](k int) *HeavyHitters[K] {
+	if k <= 0 {
+		k = 1
+	}
+	return &HeavyHitters[K]{
+		k:     k,
+		items: make(hitterHeap[K], 0, k),
+		index: make(map[K]*hitterItem[K], k),
+	}
+}
+
+// Offer records the estimated count of key.
+func (h *HeavyHitters[K]) Offer(key K, count int) {
+	// 不大于堆顶的估算值不能替换堆顶；如果key已经在堆中，它的计数不大于新的估算值，也就等于堆顶，不需要更新
+	if int64(count) <= h.threshold.Load() {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	defer h.updateThreshold()
+
+	if item, ok := h.index[key]; ok {
+		item.Count = count
+		heap.Fix(&h.items, item.pos)
+		return
+	}
+	if len(h.items) < h.k {
+		item := &hitterItem[K]{HeavyHitter: HeavyHitter[K]{Key: key, Count: count}}
+		heap.Push(&h.items, item)
+		h.index[key] = item
+		return
+	}
+	if coldest := h.items[0]; count > coldest.Count { // 比堆顶（最冷的key）更热，替换堆顶
+		delete(h.index, coldest.Key)
+		coldest.Key, coldest.Count = key, count
+		h.index[key] = coldest
+		heap.Fix(&h.items, 0)
+	}
+}
+
+// Remove stops tracking key.
+func (h *HeavyHitters[K]) Remove(key K) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if item, ok := h.index[key]; ok {
+		heap.Remove(&h.items, item.pos)
+		delete(h.index, key)
+		h.updateThreshold()
+	}
+}
+
+// updateThreshold records the count of the coldest key once k keys are tracked. It must be called with the lock held.
+func (h *HeavyHitters[K]) updateThreshold() {
+	if len(h.items) < h.k {
+		h.threshold.Store(0)
+	} else {
+		h.threshold.Store(int64(h.items[0].Count))
+	}
+}
+
+// halve divides every tracked count by two, following the aging of the sketch.
+func (h *HeavyHitters[K]) halve() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, item := range h.items {
+		item.Count >>= 1 // 所有元素同时减半，堆的顺序不变
+	}
+	h.updateThreshold()
+}
+
+// TopK returns the tracked keys ordered from the hottest to the coldest.
+func (h *HeavyHitters[K]) TopK() []HeavyHitter[K] {
+	h.mu.Lock()
+	hitters := make([]HeavyHitter[K], len(h.items))
+	for i, item := range h.items {
+		hitters[i] = item.HeavyHitter
+	}
+	h.mu.Unlock()
+
+	sort.SliceStable(hitters, func(i, j int) bool { return hitters[i].Count > hitters[j].Count })
+	return hitters
+}
+
+// hitterHeap is a min-heap ordered by Count, implementing heap.Interface.
+type hitterHeap[K global.Key] []*hitterItem[K]
+
+func (h hitterHeap[K]) Len() int           { return len(h) }
+func (h hitterHeap[K]) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h hitterHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+func (h *hitterHeap[K]) Push(x any) {
+	item := x.(*hitterItem[K])
+	item.pos = len(*h)
+	*h = append(*h, item)
+}
+func (h *hitterHeap[K]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil // avoid memory leaks
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,55 @@
+package frequncy_sketch_test
+
+import (
+	fs "gaffeine/frequncy_sketch"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestHeavyHitters_topK(t *testing.T) {
+	hitters := fs.NewHeavyHitters[string](2)
+	hitters.Offer("a", 1)
+	hitters.Offer("b", 5)
+	hitters.Offer("c", 3) // 替换最冷的a
+	hitters.Offer("d", 2) // 比最冷的c还冷，忽略
+
+	assert.Equal(t, []fs.HeavyHitter[string]{{Key: "b", Count: 5}, {Key: "c", Count: 3}}, hitters.TopK())
+
+	hitters.Offer("c", 7) // 更新已有的key
+	assert.Equal(t, []fs.HeavyHitter[string]{{Key: "c", Count: 7}, {Key: "b", Count: 5}}, hitters.TopK())
+
+	hitters.Remove("c")
+	assert.Equal(t, []fs.HeavyHitter[string]{{Key: "b", Count: 5}}, hitters.TopK())
+	hitters.Offer("d", 2) // 删除之后堆没有满，又可以加入更冷的key
+	assert.Equal(t, []fs.HeavyHitter[string]{{Key: "b", Count: 5}, {Key: "d", Count: 2}}, hitters.TopK())
+	hitters.Offer("e", 2) // 和最冷的d一样，忽略
+	hitters.Offer("d", 6) // 最冷的key变热
+	assert.Equal(t, []fs.HeavyHitter[string]{{Key: "d", Count: 6}, {Key: "b", Count: 5}}, hitters.TopK())
+}
+
+func TestHeavyHitters_sketch(t *testing.T) {
+	sketch := fs.NewBuilder[int]().MaximumSize(512).HeavyHitters(3).Build()
+	sketch.SampleSize = math.MaxInt32
+	assert.Nil(t, makeSketch(512).HeavyHitters())
+
+	for i := 100; i < 1000; i++ {
+		sketch.Increment(i)
+	}
+	for i := 1; i <= 5; i++ {
+		for j := 0; j < 2*i; j++ {
+			sketch.Increment(i)
+		}
+	}
+
+	top := sketch.HeavyHitters()
+	assert.Equal(t, 3, len(top))
+	assert.Equal(t, []int{5, 4, 3}, []int{top[0].Key, top[1].Key, top[2].Key})
+	assert.Equal(t, sketch.Frequency(5), top[0].Count)
+
+	sketch.Reset()
+	assert.Equal(t, sketch.Frequency(5), sketch.HeavyHitters()[0].Count)
+
+	sketch.TrackHeavyHitters(0)
+	assert.Nil(t, sketch.HeavyHitters())
+}
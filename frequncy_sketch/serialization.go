@@ -0,0 +1,104 @@
+package frequncy_sketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// The binary format of a sketch, all integers are little endian:
+//
+//	magic       4 bytes  "GFSK"
+//	version     1 byte   currently 1
+//	depth       1 byte
+//	counterBits 1 byte
+//	flags       1 byte   bit 0: conservative update
+//	SampleSize  8 bytes
+//	Size        8 bytes
+//	BlockMask   8 bytes
+//	length      8 bytes  the number of slots of Table
+//	Table       8 bytes per slot
+//	checksum    4 bytes  CRC-32 (IEEE) of all the preceding bytes
+const (
+	serializationMagic   = "GFSK"
+	serializationVersion = 1
+	headerLength         = 4 + 4 + 8*4
+	checksumLength       = 4
+
+	flagConservative = 1 << 0
+)
+
+var (
+	ErrCorruptedSketch    = errors.New("frequncy_sketch: corrupted sketch data")
+	ErrUnsupportedVersion = errors.New("frequncy_sketch: unsupported sketch data version")
+)
+
+// MarshalBinary encodes the popularity history of the sketch, so that it can be saved at shutdown
+// and restored by UnmarshalBinary at startup. It must not race with Increment or Reset.
+func (f *FrequencySketch[K]) MarshalBinary() ([]byte, error) {
+	data := make([]byte, headerLength, headerLength+8*len(f.Table)+checksumLength)
+	copy(data, serializationMagic)
+	data[4] = serializationVersion
+	data[5] = byte(f.depth)
+	data[6] = byte(f.counterBits)
+	if f.conservative {
+		data[7] |= flagConservative
+	}
+	binary.LittleEndian.PutUint64(data[8:], uint64(f.SampleSize))
+	binary.LittleEndian.PutUint64(data[16:], uint64(f.Size))
+	binary.LittleEndian.PutUint64(data[24:], uint64(f.BlockMask))
+	binary.LittleEndian.PutUint64(data[32:], uint64(len(f.Table)))
+	for i := range f.Table {
+		data = binary.LittleEndian.AppendUint64(data, uint64(f.load(i)))
+	}
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// UnmarshalBinary replaces the state of the sketch with the data encoded by MarshalBinary.
+// The depth, the counter width and conservative update are restored as well, while a concurrent sketch stays concurrent.
+// On error the sketch is left unchanged. It must not race with other methods.
+func (f *FrequencySketch[K]) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLength+checksumLength || string(data[:4]) != serializationMagic {
+		return ErrCorruptedSketch
+	}
+	if data[4] != serializationVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[4])
+	}
+	body := data[:len(data)-checksumLength]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(body):]) {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptedSketch)
+	}
+
+	depth, counterBits := int(data[5]), int(data[6])
+	if depth != 1 && depth != 2 && depth != 4 && depth != 8 {
+		return fmt.Errorf("%w: depth %d", ErrCorruptedSketch, depth)
+	}
+	if counterBits != DefaultCounterBits && counterBits != WideCounterBits {
+		return fmt.Errorf("%w: counter bits %d", ErrCorruptedSketch, counterBits)
+	}
+	sampleSize := int64(binary.LittleEndian.Uint64(data[8:]))
+	size := int64(binary.LittleEndian.Uint64(data[16:]))
+	if sampleSize <= 0 || size < 0 || size > sampleSize {
+		return fmt.Errorf("%w: size %d and sample size %d", ErrCorruptedSketch, size, sampleSize)
+	}
+	blockMask := binary.LittleEndian.Uint64(data[24:])
+	length := binary.LittleEndian.Uint64(data[32:])
+	// table的长度必须是2的幂，且至少是一个块（8个long）；用除法比较，8*length可能溢出
+	if length < 8 || length&(length-1) != 0 || blockMask != length>>3-1 || uint64(len(body)-headerLength)/8 != length ||
+		(len(body)-headerLength)%8 != 0 {
+		return fmt.Errorf("%w: table length %d and block mask %d", ErrCorruptedSketch, length, blockMask)
+	}
+
+	table := make([]int64, length)
+	for i := range table {
+		table[i] = int64(binary.LittleEndian.Uint64(body[headerLength+8*i:]))
+	}
+	f.configure(depth, counterBits)
+	f.conservative = data[7]&flagConservative != 0
+	f.SampleSize = int(sampleSize)
+	f.Size = int(size)
+	f.BlockMask = int(blockMask)
+	f.Table = table
+	return nil
+}
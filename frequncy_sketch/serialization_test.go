@@ -0,0 +1,125 @@
+package frequncy_sketch_test
+
+import (
+	"encoding"
+	"encoding/binary"
+	fs "gaffeine/frequncy_sketch"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"testing"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*fs.FrequencySketch[int])(nil)
+	_ encoding.BinaryUnmarshaler = (*fs.FrequencySketch[int])(nil)
+)
+
+func TestMarshalBinary_roundTrip(t *testing.T) {
+	sketch := makeSketch(512)
+	for i := 0; i < 1000; i++ {
+		for j := 0; j < i%7; j++ {
+			sketch.Increment(i)
+		}
+	}
+	data, err := sketch.MarshalBinary()
+	assert.Nil(t, err)
+
+	restored := fs.New[int]()
+	assert.Nil(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, sketch.Table, restored.Table)
+	assert.Equal(t, sketch.SampleSize, restored.SampleSize)
+	assert.Equal(t, sketch.Size, restored.Size)
+	assert.Equal(t, sketch.BlockMask, restored.BlockMask)
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, sketch.Frequency(i), restored.Frequency(i))
+	}
+
+	// 恢复后继续使用，Reset的行为保持一致
+	sketch.Reset()
+	restored.Reset()
+	assert.Equal(t, sketch.Table, restored.Table)
+	assert.Equal(t, sketch.Size, restored.Size)
+}
+
+func TestMarshalBinary_options(t *testing.T) {
+	sketch := fs.NewBuilder[string]().MaximumSize(64).Depth(8).CounterBits(fs.WideCounterBits).ConservativeUpdate(true).Build()
+	for i := 0; i < 100; i++ {
+		sketch.Increment("key")
+	}
+	data, _ := sketch.MarshalBinary()
+
+	restored := fs.NewConcurrent[string]()
+	assert.Nil(t, restored.UnmarshalBinary(data))
+	assert.True(t, restored.IsConcurrent())
+	assert.Equal(t, 8, restored.Depth())
+	assert.Equal(t, 255, restored.MaxFrequency())
+	assert.Equal(t, 100, restored.Frequency("key"))
+
+	restored.Increment("key")
+	assert.Equal(t, 101, restored.Frequency("key"))
+}
+
+func TestUnmarshalBinary_corrupted(t *testing.T) {
+	sketch := makeSketch(64)
+	sketch.Increment(item)
+	data, _ := sketch.MarshalBinary()
+
+	restored := makeSketch(64)
+	assert.ErrorIs(t, restored.UnmarshalBinary(nil), fs.ErrCorruptedSketch)
+	assert.ErrorIs(t, restored.UnmarshalBinary(data[:len(data)-1]), fs.ErrCorruptedSketch)
+
+	flipped := append([]byte(nil), data...)
+	flipped[50] ^= 1
+	assert.ErrorIs(t, restored.UnmarshalBinary(flipped), fs.ErrCorruptedSketch)
+
+	version := append([]byte(nil), data...)
+	version[4] = 2
+	assert.ErrorIs(t, restored.UnmarshalBinary(version), fs.ErrUnsupportedVersion)
+
+	// 失败时不修改原来的数据
+	assert.Equal(t, 0, restored.Frequency(item))
+	assert.Equal(t, 64, len(restored.Table))
+}
+
+// withHeader returns a copy of data with the 8 bytes at offset replaced by value, and a valid checksum.
+func withHeader(data []byte, offset int, value uint64) []byte {
+	data = append([]byte(nil), data...)
+	binary.LittleEndian.PutUint64(data[offset:], value)
+	body := data[:len(data)-4]
+	binary.LittleEndian.PutUint32(data[len(body):], crc32.ChecksumIEEE(body))
+	return data
+}
+
+func TestUnmarshalBinary_corruptedHeader(t *testing.T) {
+	data, _ := makeSketch(64).MarshalBinary()
+	restored := makeSketch(64)
+	for _, corrupted := range [][]byte{
+		withHeader(data, 8, 0),                                    // sample size
+		withHeader(data, 8, 1<<63),                                // 负数的sample size
+		withHeader(data, 16, 1<<40),                               // size大于sample size
+		withHeader(data, 16, 1<<63),                               // 负数的size
+		withHeader(withHeader(data, 32, 1<<61), 24, 1<<58-1),      // 8*length溢出为0
+		withHeader(withHeader(data[:44], 32, 1<<61), 24, 1<<58-1), // 没有table
+	} {
+		assert.ErrorIs(t, restored.UnmarshalBinary(corrupted), fs.ErrCorruptedSketch)
+	}
+	assert.Equal(t, 64, len(restored.Table))
+}
+
+func FuzzUnmarshalBinary(f *testing.F) {
+	sketch := makeSketch(64)
+	sketch.Increment(1)
+	data, _ := sketch.MarshalBinary()
+	f.Add(data)
+	f.Add(withHeader(withHeader(data, 32, 1<<61), 24, 1<<58-1))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		restored := makeSketch(64)
+		if restored.UnmarshalBinary(data) != nil {
+			return
+		}
+		restored.Increment(1) // 解码成功的sketch必须可以使用
+		restored.Frequency(1)
+		again, _ := restored.MarshalBinary()
+		assert.Nil(t, makeSketch(64).UnmarshalBinary(again))
+	})
+}
@@ -2,7 +2,10 @@ package gaffeine
 
 import (
 	"gaffeine/caches"
+	"gaffeine/frequncy_sketch"
 	"gaffeine/global"
+	"gaffeine/trace"
+	"time"
 )
 
 func NewBuilder[K global.Key]() *Gaffeine[K] {
@@ -15,6 +18,32 @@ func NewBuilder[K global.Key]() *Gaffeine[K] {
 type Gaffeine[K global.Key] struct {
 	maximumSize   int   // 最大cache的数量
 	maximumWeight int64 // 最大权重
+	heavyHitters  int   // 统计最热的key的个数，0表示不统计
+	sketchDepth   int   // sketch中每个key的计数器个数，0表示默认值
+	counterBits   int   // sketch中每个计数器的位数，0表示默认值
+	conservative  bool  // sketch是否使用保守更新
+	policy        caches.PolicyKind
+	recorder      *trace.Recorder // 记录访问的key，nil表示不记录
+	shards        int             // 分片的数量，0表示不分片
+
+	expireAfterWrite  time.Duration // 写入之后多久过期，0表示不过期
+	removalListener   caches.RemovalListener[K]
+	schedulerInterval time.Duration // 后台维护的间隔，0表示没有后台goroutine
+	loadTimeout       time.Duration // load的超时时间，0表示不超时
+	negativeTTL       time.Duration // ErrNotFound的缓存时间，0表示不缓存
+	negativeSize      int           // ErrNotFound的最大缓存数量，0表示默认值
+	refreshAfterWrite time.Duration // 写入之后多久在后台刷新，0表示不刷新
+	backoffInitial    time.Duration // load失败之后的最小等待时间，0表示不等待
+	backoffMax        time.Duration
+	breakerThreshold  int // 连续失败多少次之后停止load，0表示没有circuit breaker
+	breakerCooldown   time.Duration
+
+	writer              caches.CacheWriter[K] // nil表示没有writer
+	writeBehindInterval time.Duration         // 0表示write-through
+	writeBehindBatch    int
+	writeRetries        int
+	onWriteError        caches.WriteErrorHandler[K]
+	codec               caches.Codec[any] // snapshot中值的编码，nil表示gob
 }
 
 func (g *Gaffeine[K]) MaximumSize(size int) *Gaffeine[K] {
@@ -27,12 +56,237 @@ func (g *Gaffeine[K]) MaximumWeight(weight int64) *Gaffeine[K] {
 	return g
 }
 
+// HeavyHitters makes the cache track its k hottest keys, which are reported by caches.Inspector.
+func (g *Gaffeine[K]) HeavyHitters(k int) *Gaffeine[K] {
+	g.heavyHitters = k
+	return g
+}
+
+// SketchDepth sets the number of counters of each key in the frequency sketch of W-TinyLFU: 1, 2, 4 (the default)
+// or 8. A larger depth lowers the over-estimation of cold keys at the cost of touching more counters per access.
+// See frequncy_sketch.Builder.Depth.
+func (g *Gaffeine[K]) SketchDepth(depth int) *Gaffeine[K] {
+	g.sketchDepth = depth
+	return g
+}
+
+// SketchCounterBits sets the width of the counters of the frequency sketch of W-TinyLFU: 4 (the default), which
+// saturate at 15, or 8, which saturate at 255 and take twice the memory. See frequncy_sketch.Builder.CounterBits.
+func (g *Gaffeine[K]) SketchCounterBits(bits int) *Gaffeine[K] {
+	g.counterBits = bits
+	return g
+}
+
+// ConservativeUpdate makes the frequency sketch of W-TinyLFU only increment the counters of a key that equal its
+// current estimate, see frequncy_sketch.Builder.ConservativeUpdate.
+func (g *Gaffeine[K]) ConservativeUpdate(enabled bool) *Gaffeine[K] {
+	g.conservative = enabled
+	return g
+}
+
+// EvictionPolicy selects the eviction policy, W-TinyLFU (caches.TinyLFUPolicy) by default.
+// Heavy hitters are only tracked by W-TinyLFU, whose admission relies on the same sketch, and the options of the sketch
+// only apply to W-TinyLFU.
+func (g *Gaffeine[K]) EvictionPolicy(kind caches.PolicyKind) *Gaffeine[K] {
+	g.policy = kind
+	return g
+}
+
+// Shards splits the W-TinyLFU cache into n independently locked shards, see caches.ShardedCache, which makes the
+// built cache safe for concurrent use. A non-positive n selects caches.DefaultShards, a power of two near GOMAXPROCS.
+// A small cache gets fewer shards, see caches.NewShardedCache.
+func (g *Gaffeine[K]) Shards(n int) *Gaffeine[K] {
+	if n <= 0 {
+		n = caches.DefaultShards()
+	}
+	g.shards = n
+	return g
+}
+
+// ExpireAfterWrite expires the entries d after they were set, see caches.ManagedCache.
+func (g *Gaffeine[K]) ExpireAfterWrite(d time.Duration) *Gaffeine[K] {
+	g.expireAfterWrite = d
+	return g
+}
+
+// RemovalListener notifies listener of every removal, see caches.ManagedCache.
+func (g *Gaffeine[K]) RemovalListener(listener caches.RemovalListener[K]) *Gaffeine[K] {
+	g.removalListener = listener
+	return g
+}
+
+// Scheduler runs the maintenance of the cache, expiring entries and notifying the removal listener, in a background
+// goroutine every interval, so that it also happens when the cache is idle. The built cache is a caches.Maintainer,
+// which must be closed when done.
+func (g *Gaffeine[K]) Scheduler(interval time.Duration) *Gaffeine[K] {
+	g.schedulerInterval = interval
+	return g
+}
+
+// Writer passes Set and Invalidate to writer, synchronously unless WriteBehind is set, see caches.ManagedConfig.Writer.
+func (g *Gaffeine[K]) Writer(writer caches.CacheWriter[K]) *Gaffeine[K] {
+	g.writer = writer
+	return g
+}
+
+// WriteBehind passes the writes to the writer in the background, coalesced per key, every interval or as soon as
+// batch keys are pending, retrying a failed write retries times. The built cache must be closed when done.
+// See caches.ManagedConfig.WriteBehindInterval.
+func (g *Gaffeine[K]) WriteBehind(interval time.Duration, batch, retries int) *Gaffeine[K] {
+	g.writeBehindInterval = interval
+	g.writeBehindBatch = batch
+	g.writeRetries = retries
+	return g
+}
+
+// OnWriteError is called with the writes given up by the writer.
+func (g *Gaffeine[K]) OnWriteError(handler caches.WriteErrorHandler[K]) *Gaffeine[K] {
+	g.onWriteError = handler
+	return g
+}
+
+// SnapshotCodec encodes the values of the snapshots of caches.ManagedCache.SaveTo and LoadFrom, instead of gob.
+func (g *Gaffeine[K]) SnapshotCodec(codec caches.Codec[any]) *Gaffeine[K] {
+	g.codec = codec
+	return g
+}
+
+// LoadTimeout bounds every load of the cache built by BuildLoading, whose Get then returns caches.ErrLoadTimeout.
+func (g *Gaffeine[K]) LoadTimeout(d time.Duration) *Gaffeine[K] {
+	g.loadTimeout = d
+	return g
+}
+
+// NegativeCaching caches the loads of the cache built by BuildLoading failing with caches.ErrNotFound for ttl, in
+// at most size negative entries, or a tenth of the maximum size if size is not positive.
+// See caches.LoadingConfig.NegativeTTL.
+func (g *Gaffeine[K]) NegativeCaching(ttl time.Duration, size int) *Gaffeine[K] {
+	g.negativeTTL = ttl
+	g.negativeSize = size
+	return g
+}
+
+// RefreshAfterWrite reloads in the background the entries of the cache built by BuildLoading read d after they were
+// set, see caches.LoadingConfig.RefreshAfterWrite.
+func (g *Gaffeine[K]) RefreshAfterWrite(d time.Duration) *Gaffeine[K] {
+	g.refreshAfterWrite = d
+	return g
+}
+
+// Backoff postpones the next load of a key of the cache built by BuildLoading after it failed, by initial doubling
+// after every consecutive failure up to max. See caches.LoadingConfig.BackoffInitial.
+func (g *Gaffeine[K]) Backoff(initial, max time.Duration) *Gaffeine[K] {
+	g.backoffInitial = initial
+	g.backoffMax = max
+	return g
+}
+
+// CircuitBreaker stops the loads of the cache built by BuildLoading for cooldown after threshold consecutive failed
+// loads, serving the entries due for a refresh meanwhile. See caches.LoadingConfig.BreakerThreshold.
+func (g *Gaffeine[K]) CircuitBreaker(threshold int, cooldown time.Duration) *Gaffeine[K] {
+	g.breakerThreshold = threshold
+	g.breakerCooldown = cooldown
+	return g
+}
+
+// RecordTrace records the key of every Get and Set to recorder, see caches.RecordingCache.
+// The caller owns the recorder and closes it when done.
+func (g *Gaffeine[K]) RecordTrace(recorder *trace.Recorder) *Gaffeine[K] {
+	g.recorder = recorder
+	return g
+}
+
 func (g *Gaffeine[K]) Build() caches.Cache[K] {
+	cache := g.build()
+	if g.recorder != nil {
+		return caches.NewRecordingCache[K](cache, g.recorder)
+	}
+	return cache
+}
+
+// BuildLoading builds a W-TinyLFU cache loading the missing keys with loader, see caches.LoadingCache.
+// Its traffic is not recorded by RecordTrace.
+func (g *Gaffeine[K]) BuildLoading(loader caches.Loader[K]) *caches.LoadingCache[K] {
+	g.checkManaged()
+	return caches.NewLoadingCache[K](g.maximumSize, loader, caches.LoadingConfig[K]{
+		Managed:           g.managedConfig(),
+		LoadTimeout:       g.loadTimeout,
+		NegativeTTL:       g.negativeTTL,
+		NegativeSize:      g.negativeSize,
+		RefreshAfterWrite: g.refreshAfterWrite,
+		BackoffInitial:    g.backoffInitial,
+		BackoffMax:        g.backoffMax,
+		BreakerThreshold:  g.breakerThreshold,
+		BreakerCooldown:   g.breakerCooldown,
+	})
+}
+
+func (g *Gaffeine[K]) build() caches.Cache[K] {
 	//if g.maximumWeight != -1 { // 走基于权重的设置
 	//	return &caches.WeightCache[K]{}
 	//}
-	if g.maximumSize == -1 { // 不走基于权重的设置
-		return &caches.SizeCache[K]{}
+	if g.managed() {
+		g.checkManaged()
+		return caches.NewManagedCache[K](g.maximumSize, g.managedConfig())
+	}
+	if g.policy != caches.TinyLFUPolicy {
+		return caches.NewCache[K](g.policy, g.maximumSize)
+	}
+	sketch := g.sketch()
+	if g.shards > 0 {
+		cache := caches.NewShardedCache[K](g.maximumSize, g.shards)
+		if sketch != nil {
+			cache.ConfigureSketch(sketch)
+		}
+		return cache.TrackHeavyHitters(g.heavyHitters)
+	}
+	cache := caches.NewSizeCache[K](g.maximumSize) // 不走基于权重的设置
+	if sketch != nil {
+		cache.ConfigureSketch(sketch)
+	}
+	cache.Sketch.TrackHeavyHitters(g.heavyHitters)
+	return cache
+}
+
+// sketch returns the builder of the sketch of W-TinyLFU, or nil to keep the default sketch.
+func (g *Gaffeine[K]) sketch() *frequncy_sketch.Builder[K] {
+	if g.sketchDepth == 0 && g.counterBits == 0 && !g.conservative {
+		return nil
+	}
+	b := frequncy_sketch.NewBuilder[K]().ConservativeUpdate(g.conservative)
+	if g.sketchDepth != 0 {
+		b.Depth(g.sketchDepth)
+	}
+	if g.counterBits != 0 {
+		b.CounterBits(g.counterBits)
+	}
+	return b
+}
+
+// managed reports whether the cache needs the maintenance of caches.ManagedCache.
+func (g *Gaffeine[K]) managed() bool {
+	return g.expireAfterWrite > 0 || g.removalListener != nil || g.schedulerInterval > 0 || g.writer != nil || g.codec != nil
+}
+
+func (g *Gaffeine[K]) checkManaged() {
+	if g.policy != caches.TinyLFUPolicy || g.shards > 0 {
+		panic("gaffeine: expiration, removal listener, scheduler, writer and loading need the W-TinyLFU policy without shards")
+	}
+}
+
+func (g *Gaffeine[K]) managedConfig() caches.ManagedConfig[K] {
+	return caches.ManagedConfig[K]{
+		ExpireAfterWrite:  g.expireAfterWrite,
+		RemovalListener:   g.removalListener,
+		SchedulerInterval: g.schedulerInterval,
+		HeavyHitters:      g.heavyHitters,
+		Sketch:            g.sketch(),
+		Codec:             g.codec,
+
+		Writer:              g.writer,
+		WriteBehindInterval: g.writeBehindInterval,
+		WriteBehindBatch:    g.writeBehindBatch,
+		WriteRetries:        g.writeRetries,
+		OnWriteError:        g.onWriteError,
 	}
-	return nil
 }
@@ -1 +1,270 @@
 package gaffeine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"gaffeine/caches"
+	"gaffeine/trace"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuild_heavyHitters(t *testing.T) {
+	cache := NewBuilder[string]().MaximumSize(100).HeavyHitters(2).Build()
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	for i := 0; i < 3; i++ {
+		cache.Get("b")
+	}
+
+	inspector, ok := cache.(caches.Inspector[string])
+	assert.True(t, ok)
+	top := inspector.HeavyHitters()
+	assert.Equal(t, 2, len(top))
+	assert.Equal(t, "b", top[0].Key)
+	assert.Equal(t, 4, top[0].Count)
+}
+
+func TestBuild_sketch(t *testing.T) {
+	cache := NewBuilder[string]().MaximumSize(100).SketchDepth(8).SketchCounterBits(8).ConservativeUpdate(true).Build()
+	sketch := cache.(*caches.SizeCache[string]).Sketch
+	assert.Equal(t, 8, sketch.Depth())
+	assert.Equal(t, 255, sketch.MaxFrequency())
+	cache.Set("a", 1)
+	for i := 0; i < 20; i++ {
+		cache.Get("a")
+	}
+	assert.Equal(t, 21, sketch.Frequency("a"))
+
+	managed := NewBuilder[string]().MaximumSize(100).ExpireAfterWrite(time.Hour).SketchCounterBits(8).HeavyHitters(1).Build()
+	sketch = managed.(*caches.ManagedCache[string]).SizeCache().Sketch
+	assert.Equal(t, 4, sketch.Depth())
+	assert.Equal(t, 255, sketch.MaxFrequency())
+	managed.Set("a", 1)
+	managed.Get("a")
+	assert.Nil(t, managed.(*caches.ManagedCache[string]).CleanUp())
+	assert.Equal(t, "a", managed.(*caches.ManagedCache[string]).HeavyHitters()[0].Key) // 替换sketch之后仍然统计
+	assert.Equal(t, 15, NewBuilder[string]().MaximumSize(100).Build().(*caches.SizeCache[string]).Sketch.MaxFrequency())
+
+	assert.Panics(t, func() { NewBuilder[string]().MaximumSize(100).SketchDepth(3).Build() })
+}
+
+func TestBuild_evictionPolicy(t *testing.T) {
+	cache := NewBuilder[int]().MaximumSize(100).Build()
+	_, ok := cache.(*caches.SizeCache[int])
+	assert.True(t, ok)
+
+	cache = NewBuilder[int]().MaximumSize(100).EvictionPolicy(caches.ARCPolicy).Build()
+	_, ok = cache.(*caches.ARCCache[int])
+	assert.True(t, ok)
+
+	cache = NewBuilder[int]().MaximumSize(100).EvictionPolicy(caches.S3FIFOPolicy).Build()
+	_, ok = cache.(*caches.S3FIFOCache[int])
+	assert.True(t, ok)
+
+	cache = NewBuilder[int]().MaximumSize(100).EvictionPolicy(caches.LIRSPolicy).Build()
+	_, ok = cache.(*caches.LIRSCache[int])
+	assert.True(t, ok)
+
+	cache = NewBuilder[int]().MaximumSize(100).EvictionPolicy(caches.ClockProPolicy).Build()
+	_, ok = cache.(*caches.ClockProCache[int])
+	assert.True(t, ok)
+
+	for _, kind := range []caches.PolicyKind{caches.LRUPolicy, caches.LFUPolicy, caches.FIFOPolicy, caches.SIEVEPolicy} {
+		cache = NewBuilder[int]().MaximumSize(2).EvictionPolicy(kind).Build()
+		policyCache, ok := cache.(*caches.PolicyCache[int])
+		assert.True(t, ok, kind.String())
+		assert.Equal(t, 2, policyCache.MaximumSize)
+
+		cache.Set(1, 1)
+		cache.Set(2, 2)
+		cache.Set(3, 3)
+		assert.Equal(t, 2, policyCache.Len(), kind.String())
+	}
+}
+
+func TestBuild_recordTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.gz")
+	recorder, err := trace.NewRecorder(path, trace.RecorderConfig{})
+	assert.Nil(t, err)
+	cache := NewBuilder[int]().MaximumSize(100).HeavyHitters(1).RecordTrace(recorder).Build()
+	cache.Set(1, "a")
+	cache.Get(1)
+	cache.Get(-2)
+	assert.Nil(t, recorder.Close())
+
+	_, ok := cache.(caches.Inspector[int])
+	assert.True(t, ok)
+
+	r, err := trace.Open(path, trace.RecordFormat)
+	assert.Nil(t, err)
+	defer r.Close()
+	var events []trace.Event
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		events = append(events, event)
+	}
+	assert.Equal(t, []trace.Event{{Key: "1", Size: 1, Op: trace.Set}, {Key: "1", Size: 1}, {Key: "-2", Size: 1}}, events)
+}
+
+func TestBuild_shards(t *testing.T) {
+	cache := NewBuilder[int]().MaximumSize(1000).Shards(3).HeavyHitters(1).Build()
+	sharded, ok := cache.(*caches.ShardedCache[int])
+	assert.True(t, ok)
+	assert.Equal(t, 4, sharded.Shards())
+
+	cache.Set(1, "a")
+	cache.Get(1)
+	assert.Equal(t, 1, sharded.HeavyHitters()[0].Key)
+
+	cache = NewBuilder[int]().MaximumSize(1 << 20).Shards(0).Build()
+	assert.Equal(t, caches.DefaultShards(), cache.(*caches.ShardedCache[int]).Shards())
+}
+
+func TestBuild_scheduler(t *testing.T) {
+	before := runtime.NumGoroutine()
+	removed := make(chan string, 1)
+	cache := NewBuilder[string]().MaximumSize(100).
+		ExpireAfterWrite(time.Millisecond).
+		RemovalListener(func(key string, value any, cause caches.RemovalCause) { removed <- key }).
+		Scheduler(time.Millisecond).
+		Build()
+	cache.Set("a", 1)
+	select {
+	case key := <-removed: // 没有访问，由scheduler过期
+		assert.Equal(t, "a", key)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the entry did not expire")
+	}
+
+	maintainer, ok := cache.(caches.Maintainer)
+	assert.True(t, ok)
+	assert.Nil(t, maintainer.CleanUp())
+	assert.Nil(t, maintainer.Err())
+	assert.Nil(t, maintainer.Close())
+	assert.Equal(t, caches.ErrClosed, maintainer.Close())
+	assert.Equal(t, caches.ErrClosed, maintainer.Err())
+	for i := 0; i < 1000 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, before, runtime.NumGoroutine())
+}
+
+func TestBuild_schedulerNeedsTinyLFU(t *testing.T) {
+	assert.Panics(t, func() {
+		NewBuilder[int]().MaximumSize(100).EvictionPolicy(caches.LRUPolicy).Scheduler(time.Second).Build()
+	})
+	assert.Panics(t, func() {
+		NewBuilder[int]().MaximumSize(100).Shards(2).ExpireAfterWrite(time.Second).Build()
+	})
+}
+
+func TestBuild_loading(t *testing.T) {
+	var loads atomic.Int32
+	cache := NewBuilder[int]().MaximumSize(100).LoadTimeout(10*time.Millisecond).NegativeCaching(time.Minute, 10).
+		BuildLoading(func(ctx context.Context, key int) (any, error) {
+			loads.Add(1)
+			if key == 0 {
+				return nil, caches.ErrNotFound
+			}
+			if key < 0 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return key * 2, nil
+		})
+	value, err := cache.Get(context.Background(), 21)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, value)
+	_, err = cache.Get(context.Background(), -1)
+	assert.Equal(t, caches.ErrLoadTimeout, err)
+	for i := 0; i < 2; i++ {
+		_, err = cache.Get(context.Background(), 0)
+		assert.Equal(t, caches.ErrNotFound, err)
+	}
+	assert.Equal(t, int32(3), loads.Load())
+	assert.Nil(t, cache.Close())
+}
+
+func TestBuild_loadingFailures(t *testing.T) {
+	var loads atomic.Int32
+	cache := NewBuilder[int]().MaximumSize(100).Backoff(time.Minute, time.Hour).
+		CircuitBreaker(2, time.Minute).RefreshAfterWrite(time.Minute).
+		BuildLoading(func(ctx context.Context, key int) (any, error) {
+			loads.Add(1)
+			return nil, errors.New("service down")
+		})
+	for i := 0; i < 3; i++ { // backoff，不再load
+		_, err := cache.Get(context.Background(), 1)
+		assert.EqualError(t, err, "service down")
+	}
+	cache.Get(context.Background(), 2)
+	_, err := cache.Get(context.Background(), 3)
+	assert.True(t, errors.Is(err, caches.ErrCircuitOpen))
+	assert.Equal(t, int32(2), loads.Load())
+}
+
+type mapWriter map[int]any
+
+func (w mapWriter) Write(key int, value any) error {
+	w[key] = value
+	return nil
+}
+
+func (w mapWriter) Delete(key int, cause caches.RemovalCause) error {
+	if !cause.WasEvicted() {
+		delete(w, key)
+	}
+	return nil
+}
+
+func TestBuild_writer(t *testing.T) {
+	writer := mapWriter{}
+	cache := NewBuilder[int]().MaximumSize(100).Writer(writer).Build()
+	cache.Set(1, "a")
+	assert.Equal(t, mapWriter{1: "a"}, writer)
+
+	writer = mapWriter{}
+	cache = NewBuilder[int]().MaximumSize(100).Writer(writer).WriteBehind(time.Hour, 10, 1).Build()
+	cache.Set(1, "a")
+	assert.Empty(t, writer)
+	assert.Nil(t, cache.(caches.Maintainer).Close())
+	assert.Equal(t, mapWriter{1: "a"}, writer)
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(value any) ([]byte, error) { return []byte(value.(string)), nil }
+func (stringCodec) Decode(data []byte) (any, error)  { return string(data), nil }
+
+func TestBuild_snapshot(t *testing.T) {
+	saved := NewBuilder[int]().MaximumSize(100).SnapshotCodec(stringCodec{}).Build().(*caches.ManagedCache[int])
+	saved.Set(1, "a")
+	var buf bytes.Buffer
+	assert.Nil(t, saved.SaveTo(&buf))
+
+	loaded := NewBuilder[int]().MaximumSize(100).SnapshotCodec(stringCodec{}).Build().(*caches.ManagedCache[int])
+	assert.Nil(t, loaded.LoadFrom(&buf))
+	value, _ := loaded.Get(1)
+	assert.Equal(t, "a", value)
+}
+
+func TestBuild_defaultSize(t *testing.T) {
+	for _, policy := range []caches.PolicyKind{caches.ClockProPolicy, caches.LIRSPolicy} {
+		cache := NewBuilder[int]().EvictionPolicy(policy).Build()
+		for i := 0; i < 10; i++ {
+			cache.Set(i, i)
+			cache.Get(i - 1)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// WriteTable writes the hit ratios as a table, one row per size and one column per policy. A hit ratio measured
+// at a capacity other than the size is followed by the capacity in parentheses.
+func WriteTable(w io.Writer, results []Result) error {
+	policies, sizes := make([]string, 0), make([]int, 0)
+	cells := make(map[string]map[int]Result)
+	for _, result := range results {
+		if _, ok := cells[result.Policy]; !ok {
+			policies = append(policies, result.Policy)
+			cells[result.Policy] = make(map[int]Result)
+		}
+		if len(policies) == 1 {
+			sizes = append(sizes, result.Size)
+		}
+		cells[result.Policy][result.Size] = result
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "size\t")
+	for _, policy := range policies {
+		fmt.Fprintf(tw, "%s\t", policy)
+	}
+	fmt.Fprintln(tw)
+	for _, size := range sizes {
+		fmt.Fprintf(tw, "%d\t", size)
+		for _, policy := range policies {
+			cell := cells[policy][size]
+			if cell.Capacity != 0 && cell.Capacity != size {
+				fmt.Fprintf(tw, "%.2f%% (%d)\t", 100*cell.HitRatio, cell.Capacity)
+			} else {
+				fmt.Fprintf(tw, "%.2f%%\t", 100*cell.HitRatio)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes the results as CSV with a header line.
+func WriteCSV(w io.Writer, results []Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"policy", "size", "capacity", "requests", "hits", "hit_ratio"})
+	for _, result := range results {
+		cw.Write([]string{
+			result.Policy,
+			strconv.Itoa(result.Size),
+			strconv.Itoa(result.Capacity),
+			strconv.FormatInt(result.Requests, 10),
+			strconv.FormatInt(result.Hits, 10),
+			strconv.FormatFloat(result.HitRatio, 'f', 6, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the results as an indented JSON array.
+func WriteJSON(w io.Writer, results []Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
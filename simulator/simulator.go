@@ -0,0 +1,116 @@
+package simulator
+
+import (
+	"fmt"
+	"gaffeine/caches"
+	"gaffeine/trace"
+	"io"
+	"math/rand"
+)
+
+// Result is the hit ratio of one policy at one cache size.
+type Result struct {
+	Policy   string  `json:"policy"`
+	Size     int     `json:"size"`
+	Capacity int     `json:"capacity"` // the number of entries the cache can hold, which a policy may round up from Size
+	Requests int64   `json:"requests"`
+	Hits     int64   `json:"hits"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// Options tunes a simulation. Zero values select the defaults.
+type Options struct {
+	Seed int64 // seeds the random choices of W-TinyLFU between victims of the same frequency, the time by default
+	// WindowFraction is the fraction of a W-TinyLFU cache given to its admission window, caches.DefaultWindow by
+	// default. W-TinyLFU is simulated at exactly the requested size, see caches.NewSizeCacheWindow.
+	WindowFraction float64
+}
+
+type simulation struct {
+	result *Result
+	cache  caches.Cache[string]
+}
+
+// Simulate replays the trace once against every policy at every size: each key read is a request, read from the cache
+// and set on a miss, and each key written, see trace.Set, is set without counting a request. The results are ordered
+// by policy, then by size.
+func Simulate(r trace.Reader, policies []caches.PolicyKind, sizes []int) ([]Result, error) {
+	return SimulateOptions(r, policies, sizes, Options{})
+}
+
+// SimulateOptions is Simulate with options, see Options.
+func SimulateOptions(r trace.Reader, policies []caches.PolicyKind, sizes []int, options Options) ([]Result, error) {
+	results := make([]Result, 0, len(policies)*len(sizes))
+	for _, policy := range policies {
+		for _, size := range sizes {
+			results = append(results, Result{Policy: policy.String(), Size: size})
+		}
+	}
+	simulations := make([]simulation, 0, len(results))
+	for i := range results {
+		kind, _ := caches.ParsePolicyKind(results[i].Policy)
+		cache := newCache(kind, results[i].Size, options)
+		results[i].Capacity = capacity(cache)
+		simulations = append(simulations, simulation{result: &results[i], cache: cache})
+	}
+
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("simulator: read trace: %w", err)
+		}
+		for _, s := range simulations {
+			if event.Op == trace.Set {
+				s.cache.Set(event.Key, event.Size)
+				continue
+			}
+			s.result.Requests++
+			if _, ok := s.cache.Get(event.Key); ok {
+				s.result.Hits++
+			} else {
+				s.cache.Set(event.Key, event.Size)
+			}
+		}
+	}
+
+	for i := range results {
+		if results[i].Requests > 0 {
+			results[i].HitRatio = float64(results[i].Hits) / float64(results[i].Requests)
+		}
+	}
+	return results, nil
+}
+
+func newCache(kind caches.PolicyKind, size int, options Options) caches.Cache[string] {
+	if kind != caches.TinyLFUPolicy {
+		return caches.NewCache[string](kind, size)
+	}
+	cache := caches.NewSizeCacheWindow[string](size, options.WindowFraction)
+	if options.Seed != 0 {
+		cache.Rand = rand.New(rand.NewSource(options.Seed))
+	}
+	return cache
+}
+
+// capacity returns the maximum number of entries of cache.
+func capacity(cache caches.Cache[string]) int {
+	switch c := cache.(type) {
+	case *caches.SizeCache[string]:
+		return c.MaximumSize
+	case *caches.PolicyCache[string]:
+		return c.MaximumSize
+	case *caches.ARCCache[string]:
+		return c.MaximumSize
+	case *caches.S3FIFOCache[string]:
+		return c.MaximumSize
+	case *caches.LIRSCache[string]:
+		return c.MaximumSize
+	case *caches.ClockProCache[string]:
+		return c.MaximumSize
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,112 @@
+package simulator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"gaffeine/caches"
+	"gaffeine/simulator"
+	"gaffeine/trace"
+	"gaffeine/workload"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	// a b a b c a：LRU(size=2) 命中 a、b，之后 c 淘汰 a，a 不命中
+	r := trace.NewKeyReader(strings.NewReader("a\nb\na\nb\nc\na\n"))
+	results, err := simulator.Simulate(r, []caches.PolicyKind{caches.LRUPolicy, caches.FIFOPolicy}, []int{2, 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []simulator.Result{
+		{Policy: "lru", Size: 2, Capacity: 2, Requests: 6, Hits: 2, HitRatio: 2.0 / 6},
+		{Policy: "lru", Size: 3, Capacity: 3, Requests: 6, Hits: 3, HitRatio: 3.0 / 6},
+		{Policy: "fifo", Size: 2, Capacity: 2, Requests: 6, Hits: 2, HitRatio: 2.0 / 6},
+		{Policy: "fifo", Size: 3, Capacity: 3, Requests: 6, Hits: 3, HitRatio: 3.0 / 6},
+	}, results)
+}
+
+func TestSimulate_writes(t *testing.T) {
+	// set a 不算请求，之后 get a 命中；get b 不命中
+	r := trace.NewRecordReader(strings.NewReader("set a\nget a\nget b\nset b\n"))
+	results, err := simulator.Simulate(r, []caches.PolicyKind{caches.LRUPolicy}, []int{2})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), results[0].Requests)
+	assert.Equal(t, int64(1), results[0].Hits)
+}
+
+func TestSimulate_emptyTrace(t *testing.T) {
+	results, err := simulator.Simulate(trace.NewKeyReader(strings.NewReader("")), []caches.PolicyKind{caches.TinyLFUPolicy}, []int{10})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, results[0].HitRatio)
+}
+
+func TestSimulate_capacity(t *testing.T) {
+	policies := []caches.PolicyKind{
+		caches.TinyLFUPolicy, caches.LRUPolicy, caches.LFUPolicy, caches.FIFOPolicy, caches.ARCPolicy,
+		caches.S3FIFOPolicy, caches.SIEVEPolicy, caches.LIRSPolicy, caches.ClockProPolicy,
+	}
+	results, err := simulator.Simulate(trace.NewKeyReader(strings.NewReader("a\n")), policies, []int{1, 10, 1000})
+	assert.Nil(t, err)
+	for _, result := range results {
+		switch {
+		case result.Size >= 10: // 所有policy的容量都相同
+			assert.Equal(t, result.Size, result.Capacity, result.Policy)
+		case result.Policy == "tinylfu":
+			assert.Equal(t, 3, result.Capacity)
+		case result.Policy == "lirs" || result.Policy == "clockpro":
+			assert.Equal(t, 2, result.Capacity)
+		default:
+			assert.Equal(t, 1, result.Capacity, result.Policy)
+		}
+	}
+}
+
+func TestSimulate_windowFraction(t *testing.T) {
+	// 一半的请求是扫描：window越大越像LRU，热点数据越容易被扫描冲掉
+	scan := func() trace.Reader {
+		return workload.Trace(workload.NewMix(1, []float64{1, 1}, workload.NewZipf(2, 10_000, 0.99), workload.NewScan(1<<40)), 50_000)
+	}
+	policies := []caches.PolicyKind{caches.TinyLFUPolicy}
+	small, err := simulator.SimulateOptions(scan(), policies, []int{100}, simulator.Options{Seed: 1, WindowFraction: 0.01})
+	assert.Nil(t, err)
+	large, err := simulator.SimulateOptions(scan(), policies, []int{100}, simulator.Options{Seed: 1, WindowFraction: 0.9})
+	assert.Nil(t, err)
+	assert.Greater(t, small[0].HitRatio, large[0].HitRatio)
+}
+
+func TestWriteTable(t *testing.T) {
+	results := []simulator.Result{
+		{Policy: "lru", Size: 10, HitRatio: 0.5},
+		{Policy: "lru", Size: 100, HitRatio: 0.75},
+		{Policy: "arc", Size: 10, HitRatio: 0.25},
+		{Policy: "arc", Size: 100, HitRatio: 1},
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, simulator.WriteTable(&buf, results))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"size", "lru", "arc"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"10", "50.00%", "25.00%"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"100", "75.00%", "100.00%"}, strings.Fields(lines[2]))
+
+	buf.Reset()
+	assert.Nil(t, simulator.WriteTable(&buf, []simulator.Result{{Policy: "tinylfu", Size: 1, Capacity: 3, HitRatio: 0.5}}))
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{"1", "50.00%", "(3)"}, strings.Fields(lines[1])) // 容量和size不同
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, simulator.WriteCSV(&buf, []simulator.Result{{Policy: "lru", Size: 10, Requests: 4, Hits: 1, HitRatio: 0.25}}))
+	assert.Equal(t, "policy,size,capacity,requests,hits,hit_ratio\nlru,10,0,4,1,0.250000\n", buf.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	results := []simulator.Result{{Policy: "lru", Size: 10, Requests: 4, Hits: 1, HitRatio: 0.25}}
+	var buf bytes.Buffer
+	assert.Nil(t, simulator.WriteJSON(&buf, results))
+
+	decoded := make([]simulator.Result, 0)
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, results, decoded)
+}
@@ -0,0 +1,223 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// NewLIRSReader reads a trace of the LIRS authors, which holds one block number per line.
+func NewLIRSReader(r io.Reader) *KeyReader {
+	return NewKeyReader(r)
+}
+
+// ARCReader reads a trace of the ARC authors (.lis), whose lines are "start count ignored requestNumber":
+// the request reads count blocks starting from block start, so the line is expanded into count keys.
+type ARCReader struct {
+	scanner *bufio.Scanner
+	next    int64 // 下一个要返回的block
+	end     int64 // 当前行的最后一个block之后
+}
+
+func NewARCReader(r io.Reader) *ARCReader {
+	return &ARCReader{scanner: newScanner(r)}
+}
+
+func (r *ARCReader) Next() (Event, error) {
+	for r.next >= r.end {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return Event{}, err
+			}
+			return Event{}, io.EOF
+		}
+		fields := strings.Fields(r.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return Event{}, fmt.Errorf("trace: invalid arc line %q", r.scanner.Text())
+		}
+		start, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return Event{}, fmt.Errorf("trace: invalid arc start block: %w", err)
+		}
+		count, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return Event{}, fmt.Errorf("trace: invalid arc block count: %w", err)
+		}
+		r.next, r.end = start, start+count
+	}
+	key := strconv.FormatInt(r.next, 10)
+	r.next++
+	return Event{Key: key, Size: 1}, nil
+}
+
+// WikipediaReader reads a CDN style trace whose lines are "timestamp key size", separated by spaces.
+type WikipediaReader struct {
+	scanner *bufio.Scanner
+}
+
+func NewWikipediaReader(r io.Reader) *WikipediaReader {
+	return &WikipediaReader{scanner: newScanner(r)}
+}
+
+func (r *WikipediaReader) Next() (Event, error) {
+	for r.scanner.Scan() {
+		fields := strings.Fields(r.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return Event{}, fmt.Errorf("trace: invalid wikipedia line %q", r.scanner.Text())
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return Event{}, fmt.Errorf("trace: invalid wikipedia size: %w", err)
+		}
+		return Event{Key: fields[1], Size: size}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// CachelibReader reads a CacheLib kvcache CSV trace. The columns are found by the header:
+// the key is the "key" column, the size is the "size" column, or the sum of "key_size" and "value_size",
+// and a request with an "op_count" column is repeated op_count times, so a record with an op_count of 0 is skipped.
+type CachelibReader struct {
+	reader                            *csv.Reader
+	key, size, keySize, valueSize, op int // 列的下标，-1表示没有这一列
+	header                            bool
+	pending                           Event // 需要重复返回的请求
+	repeat                            int64
+}
+
+func NewCachelibReader(r io.Reader) *CachelibReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &CachelibReader{reader: reader}
+}
+
+func (r *CachelibReader) Next() (Event, error) {
+	if r.repeat > 0 {
+		r.repeat--
+		return r.pending, nil
+	}
+	if !r.header {
+		if err := r.readHeader(); err != nil {
+			return Event{}, err
+		}
+	}
+
+	for {
+		record, err := r.reader.Read()
+		if err != nil {
+			return Event{}, err
+		}
+		if r.key >= len(record) {
+			return Event{}, fmt.Errorf("trace: cachelib record without key: %v", record)
+		}
+		event := Event{Key: record[r.key], Size: 1}
+		if r.size >= 0 {
+			event.Size, err = r.parse(record, r.size)
+		} else if r.keySize >= 0 || r.valueSize >= 0 {
+			var keySize, valueSize int64
+			if keySize, err = r.parse(record, r.keySize); err == nil {
+				valueSize, err = r.parse(record, r.valueSize)
+			}
+			event.Size = keySize + valueSize
+		}
+		if err != nil {
+			return Event{}, err
+		}
+		if r.op >= 0 {
+			count, err := r.parse(record, r.op)
+			if err != nil {
+				return Event{}, err
+			}
+			if count <= 0 { // 没有请求，读取下一条记录
+				continue
+			}
+			r.pending, r.repeat = event, count-1
+		}
+		return event, nil
+	}
+}
+
+func (r *CachelibReader) readHeader() error {
+	header, err := r.reader.Read()
+	if err != nil {
+		return err
+	}
+	r.key, r.size, r.keySize, r.valueSize, r.op = -1, -1, -1, -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "key":
+			r.key = i
+		case "size":
+			r.size = i
+		case "key_size":
+			r.keySize = i
+		case "value_size":
+			r.valueSize = i
+		case "op_count":
+			r.op = i
+		}
+	}
+	if r.key < 0 {
+		return fmt.Errorf("trace: cachelib header without key column: %v", header)
+	}
+	r.header = true
+	return nil
+}
+
+// parse returns the integer of column i, 0 if the column does not exist.
+func (r *CachelibReader) parse(record []string, i int) (int64, error) {
+	if i < 0 || i >= len(record) {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(record[i]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("trace: invalid cachelib number: %w", err)
+	}
+	return v, nil
+}
+
+// TwitterReader reads a Twitter cache-trace CSV without header, whose columns are
+// "timestamp, key, key size, value size, client id, operation, TTL". The size is the key size plus the value size.
+type TwitterReader struct {
+	reader *csv.Reader
+}
+
+func NewTwitterReader(r io.Reader) *TwitterReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	reader.LazyQuotes = true
+	return &TwitterReader{reader: reader}
+}
+
+func (r *TwitterReader) Next() (Event, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return Event{}, err
+	}
+	if len(record) < 4 {
+		return Event{}, fmt.Errorf("trace: invalid twitter record: %v", record)
+	}
+	keySize, err := strconv.ParseInt(record[2], 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("trace: invalid twitter key size: %w", err)
+	}
+	valueSize, err := strconv.ParseInt(record[3], 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("trace: invalid twitter value size: %w", err)
+	}
+	return Event{Key: record[1], Size: keySize + valueSize}, nil
+}
@@ -0,0 +1,71 @@
+package trace_test
+
+import (
+	"gaffeine/trace"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readEvents reads all the events of a trace.
+func readEvents(t *testing.T, r trace.Reader) []trace.Event {
+	events := make([]trace.Event, 0)
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			return events
+		}
+		if !assert.Nil(t, err) {
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+func TestLIRSReader(t *testing.T) {
+	r := trace.NewLIRSReader(strings.NewReader("1\n2\n1\n"))
+	assert.Equal(t, []string{"1", "2", "1"}, readKeys(t, r))
+}
+
+func TestARCReader(t *testing.T) {
+	r := trace.NewARCReader(strings.NewReader("10 3 0 1\n\n5 1 0 2\n"))
+	assert.Equal(t, []string{"10", "11", "12", "5"}, readKeys(t, r))
+
+	_, err := trace.NewARCReader(strings.NewReader("10\n")).Next()
+	assert.NotNil(t, err)
+	_, err = trace.NewARCReader(strings.NewReader("x 1\n")).Next()
+	assert.NotNil(t, err)
+}
+
+func TestWikipediaReader(t *testing.T) {
+	r := trace.NewWikipediaReader(strings.NewReader("1000 /wiki/Go 2048\n1001 /wiki/Cache 512\n"))
+	assert.Equal(t, []trace.Event{{Key: "/wiki/Go", Size: 2048}, {Key: "/wiki/Cache", Size: 512}}, readEvents(t, r))
+
+	_, err := trace.NewWikipediaReader(strings.NewReader("1000 /wiki/Go\n")).Next()
+	assert.NotNil(t, err)
+}
+
+func TestCachelibReader(t *testing.T) {
+	data := "op_time,key,key_size,op,op_count,value_size\n" +
+		"1,a,10,GET,2,100\n" +
+		"2,z,30,GET,0,300\n" + // op_count为0，没有请求
+		"3,b,20,SET,1,200\n"
+	r := trace.NewCachelibReader(strings.NewReader(data))
+	assert.Equal(t, []trace.Event{{Key: "a", Size: 110}, {Key: "a", Size: 110}, {Key: "b", Size: 220}}, readEvents(t, r))
+
+	r = trace.NewCachelibReader(strings.NewReader("key,size\nc,7\n"))
+	assert.Equal(t, []trace.Event{{Key: "c", Size: 7}}, readEvents(t, r))
+
+	_, err := trace.NewCachelibReader(strings.NewReader("op_time,size\n1,2\n")).Next()
+	assert.NotNil(t, err)
+}
+
+func TestTwitterReader(t *testing.T) {
+	data := "0,key1,10,90,1,get,0\n1,key2,20,180,2,set,3600\n"
+	r := trace.NewTwitterReader(strings.NewReader(data))
+	assert.Equal(t, []trace.Event{{Key: "key1", Size: 100}, {Key: "key2", Size: 200}}, readEvents(t, r))
+
+	_, err := trace.NewTwitterReader(strings.NewReader("0,key1\n")).Next()
+	assert.NotNil(t, err)
+}
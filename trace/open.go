@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Format is the format of a trace file.
+type Format string
+
+const (
+	KeysFormat      Format = "keys" // one key per line
+	LIRSFormat      Format = "lirs"
+	ARCFormat       Format = "arc"
+	WikipediaFormat Format = "wikipedia"
+	CachelibFormat  Format = "cachelib"
+	TwitterFormat   Format = "twitter"
+	RecordFormat    Format = "record" // written by Recorder, "get <key>" or "set <key>" per line
+)
+
+// ReadCloser is a Reader of a trace file, which must be closed when done.
+type ReadCloser interface {
+	Reader
+	io.Closer
+}
+
+// NewReader returns a reader of the given format. Gzip-compressed data is detected and decompressed on the fly.
+func NewReader(r io.Reader, format Format) (Reader, error) {
+	reader, _, err := newReader(r, format)
+	return reader, err
+}
+
+// newReader is NewReader, also returning the gzip reader to close when done, or nil if the data is not compressed.
+func newReader(r io.Reader, format Format) (Reader, *gzip.Reader, error) {
+	buffered := bufio.NewReader(r)
+	var source io.Reader = buffered
+	var gz *gzip.Reader
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		if gz, err = gzip.NewReader(buffered); err != nil {
+			return nil, nil, fmt.Errorf("trace: %w", err)
+		}
+		source = gz
+	}
+
+	var reader Reader
+	switch format {
+	case KeysFormat:
+		reader = NewKeyReader(source)
+	case LIRSFormat:
+		reader = NewLIRSReader(source)
+	case ARCFormat:
+		reader = NewARCReader(source)
+	case WikipediaFormat:
+		reader = NewWikipediaReader(source)
+	case CachelibFormat:
+		reader = NewCachelibReader(source)
+	case TwitterFormat:
+		reader = NewTwitterReader(source)
+	case RecordFormat:
+		reader = NewRecordReader(source)
+	default:
+		return nil, nil, fmt.Errorf("trace: unknown format %q", format)
+	}
+	return reader, gz, nil
+}
+
+type fileReader struct {
+	Reader
+	gz   *gzip.Reader // nil表示文件没有压缩
+	file *os.File
+}
+
+func (r *fileReader) Close() error {
+	var err error
+	if r.gz != nil {
+		err = r.gz.Close()
+	}
+	return errors.Join(err, r.file.Close())
+}
+
+// Open opens the trace file at path, see NewReader.
+func Open(path string, format Format) (ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, gz, err := newReader(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileReader{Reader: r, gz: gz, file: f}, nil
+}
@@ -0,0 +1,55 @@
+package trace_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"gaffeine/trace"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gzipped(data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(data))
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestNewReader(t *testing.T) {
+	r, err := trace.NewReader(strings.NewReader("a\nb\n"), trace.KeysFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, readKeys(t, r))
+
+	_, err = trace.NewReader(strings.NewReader(""), trace.Format("unknown"))
+	assert.NotNil(t, err)
+}
+
+func TestNewReader_gzip(t *testing.T) {
+	r, err := trace.NewReader(bytes.NewReader(gzipped("1 2 0 0\n")), trace.ARCFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2"}, readKeys(t, r))
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.gz")
+	assert.Nil(t, os.WriteFile(path, gzipped("0,k,1,2,1,get,0\n"), 0o644))
+
+	r, err := trace.Open(path, trace.TwitterFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, []trace.Event{{Key: "k", Size: 3}}, readEvents(t, r))
+	assert.Nil(t, r.Close())
+
+	long := strings.Repeat("k", 100_000) // 压缩文件中的长行
+	assert.Nil(t, os.WriteFile(path, gzipped(long+"\n"), 0o644))
+	r, err = trace.Open(path, trace.KeysFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{long}, readKeys(t, r))
+	assert.Nil(t, r.Close()) // 关闭gzip reader和文件
+
+	_, err = trace.Open(filepath.Join(t.TempDir(), "missing"), trace.KeysFormat)
+	assert.NotNil(t, err)
+}
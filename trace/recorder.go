@@ -0,0 +1,281 @@
+package trace
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Recorder records the keys read and written by a live cache to a trace file, which can be replayed offline by Open
+// with RecordFormat, e.g. gaffeine-sim -format record.
+//
+// File format: a gzip stream of lines "get <key>" or "set <key>", starting with a comment line
+//
+//	# gaffeine trace v2 sample=<rate> hashed=<true|false>
+//
+// Hashed keys are the 64-bit FNV-1a hash of the raw key in 16 hex digits. Raw keys that cannot be written as a
+// line (empty, containing line breaks, starting with '#' or with surrounding blanks) are written hashed as well.
+//
+// Once the current file exceeds MaxFileSize compressed bytes it is rotated: path dir/name.gz is renamed to
+// dir/name.1.gz, the former dir/name.1.gz to dir/name.2.gz and so on, so the highest index is the oldest.
+// Concatenated gzip streams are a valid gzip stream, so `cat name.2.gz name.1.gz name.gz` is the whole capture.
+type Recorder struct {
+	path   string
+	config RecorderConfig
+	// sampleBound 采样的上界，hash小于上界的key被记录；采样率为1时不采样
+	sampleBound uint64
+
+	events  chan string // 要写入的行，不包括换行
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	dropped uint64 // 缓冲区满时丢弃的记录数量，原子操作
+
+	// 以下字段只在后台写goroutine中访问
+	file    *os.File
+	counter *countingWriter
+	gz      *gzip.Writer
+	dirty   bool // 上次flush之后有新的记录
+	err     error
+}
+
+// RecorderConfig configures a Recorder. Zero values select the defaults.
+type RecorderConfig struct {
+	// SampleRate is the fraction of keys recorded, in (0, 1], 1 by default. Keys are sampled by hash, so a sampled
+	// key is recorded on every access and the reuse distances of the trace are preserved.
+	SampleRate float64
+	// HashKeys records the hashes of the keys instead of the raw keys.
+	HashKeys bool
+	// MaxFileSize is the compressed size of a file before it is rotated, 64 MiB by default. A file may exceed it by
+	// the output of one compression block, since the size is only known once the compressor emits a block.
+	MaxFileSize int64
+	// MaxBackups is the number of rotated files kept, 8 by default. Older files are removed.
+	MaxBackups int
+	// BufferSize is the number of records queued for the background writer, 8192 by default.
+	// Records are dropped rather than blocking the cache when the queue is full, see Recorder.Dropped.
+	BufferSize int
+	// FlushInterval is how often the background writer flushes the compressed stream, 1s by default.
+	FlushInterval time.Duration
+}
+
+const (
+	defaultMaxFileSize   = 64 << 20
+	defaultMaxBackups    = 8
+	defaultBufferSize    = 8192
+	defaultFlushInterval = time.Second
+)
+
+// NewRecorder creates the trace file at path and starts the background writer. The recorder must be closed when done.
+func NewRecorder(path string, config RecorderConfig) (*Recorder, error) {
+	if config.SampleRate == 0 {
+		config.SampleRate = 1
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 || math.IsNaN(config.SampleRate) {
+		return nil, fmt.Errorf("trace: sample rate %v is not in (0, 1]", config.SampleRate)
+	}
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = defaultMaxFileSize
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = defaultMaxBackups
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultBufferSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+
+	r := &Recorder{
+		path:    path,
+		config:  config,
+		events:  make(chan string, config.BufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if config.SampleRate < 1 {
+		r.sampleBound = uint64(config.SampleRate * math.MaxUint64)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	go r.run()
+	return r, nil
+}
+
+// Record queues a read of key. It never blocks: the record is dropped if the queue is full or the recorder is closed.
+func (r *Recorder) Record(key string) {
+	r.record(Get, key)
+}
+
+// RecordSet queues a write of key, like Record.
+func (r *Recorder) RecordSet(key string) {
+	r.record(Set, key)
+}
+
+func (r *Recorder) record(op Op, key string) {
+	hashed := r.config.HashKeys || !isLine(key)
+	if r.sampleBound != 0 || hashed {
+		hash := hashKey(key)
+		if r.sampleBound != 0 && hash >= r.sampleBound {
+			return
+		}
+		if hashed {
+			key = formatHash(hash)
+		}
+	}
+
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	select {
+	case r.events <- op.String() + " " + key:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (r *Recorder) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Close writes the queued records, closes the trace file and returns the first error of the background writer.
+func (r *Recorder) Close() error {
+	r.once.Do(func() { close(r.done) })
+	<-r.stopped
+	return r.err
+}
+
+// run 后台写goroutine：写入记录，定时flush，关闭时写完队列中剩余的记录
+func (r *Recorder) run() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line := <-r.events:
+			r.write(line)
+		case <-ticker.C:
+			if r.dirty && r.err == nil {
+				r.err = r.gz.Flush()
+				r.dirty = false
+			}
+		case <-r.done:
+			for {
+				select {
+				case line := <-r.events:
+					r.write(line)
+				default:
+					r.closeFile()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(line string) {
+	if r.err != nil {
+		return
+	}
+	if _, r.err = io.WriteString(r.gz, line+"\n"); r.err != nil {
+		return
+	}
+	r.dirty = true
+	if r.counter.n >= r.config.MaxFileSize {
+		r.rotate()
+	}
+}
+
+func (r *Recorder) open() error {
+	file, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.counter = &countingWriter{w: file}
+	r.gz = gzip.NewWriter(r.counter)
+	_, err = fmt.Fprintf(r.gz, "# gaffeine trace v2 sample=%v hashed=%v\n", r.config.SampleRate, r.config.HashKeys)
+	return err
+}
+
+func (r *Recorder) closeFile() {
+	if err := r.gz.Close(); r.err == nil {
+		r.err = err
+	}
+	if err := r.file.Close(); r.err == nil {
+		r.err = err
+	}
+}
+
+// rotate 关闭当前文件，依次把备份文件的序号加1，超出MaxBackups的最旧文件被覆盖，然后创建新的文件
+func (r *Recorder) rotate() {
+	r.closeFile()
+	if r.err != nil {
+		return
+	}
+	for i := r.config.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(r.backupPath(i), r.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			r.err = err
+			return
+		}
+	}
+	if r.err = os.Rename(r.path, r.backupPath(1)); r.err != nil {
+		return
+	}
+	r.err = r.open()
+}
+
+// backupPath returns the path of the i-th rotated file, dir/name.gz -> dir/name.i.gz.
+func (r *Recorder) backupPath(i int) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "." + strconv.Itoa(i) + ext
+}
+
+// isLine reports whether key can be written in a line of the trace and read back unchanged.
+func isLine(key string) bool {
+	return key != "" && key[0] != '#' && strings.TrimSpace(key) == key && !strings.ContainsAny(key, "\r\n")
+}
+
+// hashKey returns the 64-bit FNV-1a hash of key.
+func hashKey(key string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+func formatHash(hash uint64) string {
+	const digits = "0123456789abcdef"
+	var buf [16]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = digits[hash&0xf]
+		hash >>= 4
+	}
+	return string(buf[:])
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,153 @@
+package trace_test
+
+import (
+	"bytes"
+	"gaffeine/trace"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func openKeys(t *testing.T, path string) []string {
+	r, err := trace.Open(path, trace.RecordFormat)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	defer r.Close()
+	return readKeys(t, r)
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.gz")
+	r, err := trace.NewRecorder(path, trace.RecorderConfig{})
+	assert.Nil(t, err)
+	for _, key := range []string{"a", "b", "a", "c"} {
+		r.Record(key)
+	}
+	r.RecordSet("d")
+	assert.Nil(t, r.Close())
+	assert.Nil(t, r.Close())
+	r.Record("closed") // 关闭之后的记录被丢弃
+
+	assert.Equal(t, []string{"a", "b", "a", "c", "d"}, openKeys(t, path))
+	assert.Equal(t, uint64(0), r.Dropped())
+}
+
+func TestRecorder_hashKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.gz")
+	r, err := trace.NewRecorder(path, trace.RecorderConfig{HashKeys: true})
+	assert.Nil(t, err)
+	r.Record("a")
+	r.Record("b")
+	r.Record("a")
+	assert.Nil(t, r.Close())
+
+	keys := openKeys(t, path)
+	assert.Equal(t, 3, len(keys))
+	for _, key := range keys {
+		assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{16}$"), key)
+	}
+	assert.Equal(t, keys[0], keys[2])
+	assert.NotEqual(t, keys[0], keys[1])
+}
+
+func TestRecorder_unwritableKeysAreHashed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.gz")
+	r, err := trace.NewRecorder(path, trace.RecorderConfig{})
+	assert.Nil(t, err)
+	for _, key := range []string{"", "#comment", " padded", "two\nlines", "ok"} {
+		r.Record(key)
+	}
+	assert.Nil(t, r.Close())
+
+	keys := openKeys(t, path)
+	assert.Equal(t, 5, len(keys))
+	for _, key := range keys[:4] {
+		assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{16}$"), key)
+	}
+	assert.Equal(t, "ok", keys[4])
+}
+
+func TestRecorder_sampleRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.gz")
+	r, err := trace.NewRecorder(path, trace.RecorderConfig{SampleRate: 0.25, BufferSize: 1 << 16})
+	assert.Nil(t, err)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 10000; i++ {
+			r.Record(strconv.Itoa(i))
+		}
+	}
+	assert.Nil(t, r.Close())
+	assert.Equal(t, uint64(0), r.Dropped())
+
+	counts := make(map[string]int)
+	for _, key := range openKeys(t, path) {
+		counts[key]++
+	}
+	assert.InDelta(t, 2500, len(counts), 250)
+	for key, count := range counts { // 按key采样，被采样的key的每次访问都被记录
+		assert.Equal(t, 2, count, key)
+	}
+
+	_, err = trace.NewRecorder(path, trace.RecorderConfig{SampleRate: 1.5})
+	assert.NotNil(t, err)
+}
+
+func TestRecorder_rotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "trace.gz")
+	r, err := trace.NewRecorder(path, trace.RecorderConfig{MaxFileSize: 1024, MaxBackups: 2, BufferSize: 1 << 17})
+	assert.Nil(t, err)
+	var recorded []string
+	for i := 0; i < 100000; i++ {
+		key := strconv.Itoa(i * 7919)
+		recorded = append(recorded, key)
+		r.Record(key)
+	}
+	assert.Nil(t, r.Close())
+
+	for _, name := range []string{"trace.gz", "trace.1.gz", "trace.2.gz"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.Nil(t, err, name)
+	}
+	_, err = os.Stat(filepath.Join(dir, "trace.3.gz"))
+	assert.True(t, os.IsNotExist(err))
+
+	// 从最旧的文件开始拼接，得到记录的最后一段
+	var all bytes.Buffer
+	for _, name := range []string{"trace.2.gz", "trace.1.gz", "trace.gz"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		assert.Nil(t, err)
+		all.Write(data)
+	}
+	reader, err := trace.NewReader(&all, trace.RecordFormat)
+	assert.Nil(t, err)
+	keys := readKeys(t, reader)
+	assert.Less(t, len(keys), len(recorded))
+	assert.Equal(t, recorded[len(recorded)-len(keys):], keys)
+}
+
+func BenchmarkRecorder_Record(b *testing.B) {
+	r, err := trace.NewRecorder(filepath.Join(b.TempDir(), "trace.gz"), trace.RecorderConfig{SampleRate: 0.1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			r.Record(keys[i&1023])
+			i++
+		}
+	})
+	b.StopTimer()
+	r.Close()
+}
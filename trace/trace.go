@@ -0,0 +1,101 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Op is the operation of an Event.
+type Op int
+
+const (
+	Get Op = iota // the key is read, and set by the simulator on a miss
+	Set           // the key is written, which is not a request
+)
+
+func (op Op) String() string {
+	if op == Set {
+		return "set"
+	}
+	return "get"
+}
+
+// Event is one access of a trace.
+type Event struct {
+	Key  string
+	Size int64 // 对象的大小，trace没有记录大小时为1
+	Op   Op    // 只有记录了操作的trace有Set
+}
+
+// Reader streams the events of a trace. Next returns io.EOF once the trace is exhausted.
+type Reader interface {
+	Next() (Event, error)
+}
+
+// maxLineLength bounds the lines of the line based traces, whose keys can be long URLs.
+const maxLineLength = 16 << 20
+
+// newScanner returns a scanner of the lines of r, accepting lines of up to maxLineLength bytes instead of the 64KB of
+// bufio.Scanner.
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineLength)
+	return scanner
+}
+
+// KeyReader reads a trace holding one key per line. Blank lines and lines starting with '#' are skipped.
+type KeyReader struct {
+	scanner *bufio.Scanner
+}
+
+func NewKeyReader(r io.Reader) *KeyReader {
+	return &KeyReader{scanner: newScanner(r)}
+}
+
+func (r *KeyReader) Next() (Event, error) {
+	for r.scanner.Scan() {
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return Event{Key: line, Size: 1}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// RecordReader reads a trace written by Recorder, whose lines are "get <key>" or "set <key>". Blank lines and lines
+// starting with '#' are skipped.
+type RecordReader struct {
+	scanner *bufio.Scanner
+}
+
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{scanner: newScanner(r)}
+}
+
+func (r *RecordReader) Next() (Event, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		op, key, ok := strings.Cut(line, " ")
+		switch {
+		case ok && op == "get":
+			return Event{Key: key, Size: 1, Op: Get}, nil
+		case ok && op == "set":
+			return Event{Key: key, Size: 1, Op: Set}, nil
+		default:
+			return Event{}, fmt.Errorf("trace: invalid recorded line %q", line)
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
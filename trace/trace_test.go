@@ -0,0 +1,46 @@
+package trace_test
+
+import (
+	"gaffeine/trace"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readKeys reads all the keys of a trace.
+func readKeys(t *testing.T, r trace.Reader) []string {
+	keys := make([]string, 0)
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			return keys
+		}
+		assert.Nil(t, err)
+		keys = append(keys, event.Key)
+	}
+}
+
+func TestKeyReader(t *testing.T) {
+	r := trace.NewKeyReader(strings.NewReader("# comment\na\n\n b \na\n"))
+	assert.Equal(t, []string{"a", "b", "a"}, readKeys(t, r))
+
+	_, err := r.Next()
+	assert.Equal(t, io.EOF, err)
+
+	long := strings.Repeat("k", 100_000) // 超过bufio.Scanner默认的64KB
+	r = trace.NewKeyReader(strings.NewReader("a\n" + long + "\nb\n"))
+	assert.Equal(t, []string{"a", long, "b"}, readKeys(t, r))
+}
+
+func TestRecordReader(t *testing.T) {
+	r := trace.NewRecordReader(strings.NewReader("# gaffeine trace v2\nset a\nget a\n\nget b c\n"))
+	assert.Equal(t, []trace.Event{
+		{Key: "a", Size: 1, Op: trace.Set},
+		{Key: "a", Size: 1, Op: trace.Get},
+		{Key: "b c", Size: 1, Op: trace.Get},
+	}, readEvents(t, r))
+
+	_, err := trace.NewRecordReader(strings.NewReader("a\n")).Next()
+	assert.NotNil(t, err)
+}
@@ -1,241 +1,256 @@
 package utils
 
 import (
-	"container/list"
+	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
-var aaaa_data list.List
+// Element is an element of a ConcurrentList.
+type Element[T any] struct {
+	Value T
 
-type Element struct {
-	Value interface{}
-	next  *Element
-	prev  *Element
-	list  *ConcurrentList
+	mu       sync.Mutex
+	next     atomic.Pointer[Element[T]]
+	prev     atomic.Pointer[Element[T]] // nil表示已经从list中删除
+	list     *ConcurrentList[T]         // 创建之后不再修改
+	sentinel bool                       // head或tail
 }
 
-func (e *Element) Next() *Element {
-	if p := e.next; e.list != nil && p != &e.list.root {
+// Next returns the next list element or nil. A removed element keeps its next pointer, so an iteration that
+// reaches a removed element continues with the elements that followed it.
+func (e *Element[T]) Next() *Element[T] {
+	if p := e.next.Load(); p != nil && !p.sentinel {
 		return p
 	}
 	return nil
 }
 
 // Prev returns the previous list element or nil.
-func (e *Element) Prev() *Element {
-	if p := e.prev; e.list != nil && p != &e.list.root {
+func (e *Element[T]) Prev() *Element[T] {
+	if p := e.prev.Load(); p != nil && !p.sentinel {
 		return p
 	}
 	return nil
 }
 
-type ConcurrentList struct {
-	root Element
-	len  int
+// live reports whether e is linked in its list. e must be locked.
+func (e *Element[T]) live() bool {
+	return e.sentinel || e.prev.Load() != nil
 }
 
-func NewConcurrentList() *ConcurrentList {
-	return &ConcurrentList{
-		root: Element{},
-		len:  0,
-	}
+// ConcurrentList is a doubly linked list safe for concurrent use, with a lock per element.
+//
+// Every modification locks the elements whose links it changes, from the front to the back, and validates their
+// links once locked, retrying if another goroutine changed them meanwhile. Locking adjacent elements from the front
+// cannot deadlock; MoveToFront and MoveToBack also lock elements that are not adjacent, which they only try to lock,
+// backing off when they are held. Readers follow the links without locking and see a weakly consistent view.
+type ConcurrentList[T any] struct {
+	head Element[T] // sentinel，head.next是第一个元素
+	tail Element[T] // sentinel，tail.prev是最后一个元素
+	len  atomic.Int64
 }
 
-func (l *ConcurrentList) Len() int {
-	return l.len
+func NewConcurrentList[T any]() *ConcurrentList[T] {
+	l := &ConcurrentList[T]{}
+	l.head.sentinel, l.tail.sentinel = true, true
+	l.head.list, l.tail.list = l, l
+	l.head.next.Store(&l.tail)
+	l.tail.prev.Store(&l.head)
+	return l
 }
 
-// Front returns the first element of list l or nil if the list is empty.
-func (l *ConcurrentList) Front() *Element {
-	if l.len == 0 {
-		return nil
-	}
-	return l.root.next
+func (l *ConcurrentList[T]) Len() int {
+	return int(l.len.Load())
 }
 
-// Back returns the last element of list l or nil if the list is empty.
-func (l *ConcurrentList) Back() *Element {
-	if l.len == 0 {
-		return nil
-	}
-	return l.root.prev
-}
-
-// insert inserts e after at, increments l.len, and returns e.
-func (l *ConcurrentList) insert(e, at *Element) *Element {
-	e.prev = at
-	e.next = at.next
-
-	e.prev.next = e
-	e.next.prev = e
-
-	e.list = l
-	l.len++
-	return e
-}
-
-// insertValue is a convenience wrapper for insert(&Element{Value: v}, at).
-func (l *ConcurrentList) insertValue(v any, at *Element) *Element {
-	return l.insert(&Element{Value: v}, at)
+// Front returns the first element of list l or nil if the list is empty.
+func (l *ConcurrentList[T]) Front() *Element[T] {
+	return l.head.Next()
 }
 
-// remove removes e from its list, decrements l.len
-func (l *ConcurrentList) remove(e *Element) {
-	e.prev.next = e.next
-	e.next.prev = e.prev
-	e.next = nil // avoid memory leaks
-	e.prev = nil // avoid memory leaks
-
-	e.list = nil
-	l.len--
+// Back returns the last element of list l or nil if the list is empty.
+func (l *ConcurrentList[T]) Back() *Element[T] {
+	return l.tail.Prev()
 }
 
-// move moves e to next to at.
-func (l *ConcurrentList) move(e, at *Element) {
-	if e == at {
-		return
-	}
-	e.prev.next = e.next
-	e.next.prev = e.prev
-
-	e.prev = at
-	e.next = at.next
-	e.prev.next = e
-	e.next.prev = e
+// link links e between the locked adjacent elements prev and next.
+func link[T any](e, prev, next *Element[T]) {
+	e.prev.Store(prev)
+	e.next.Store(next)
+	prev.next.Store(e)
+	next.prev.Store(e)
 }
 
-// Remove removes e from l if e is an element of list l.
-// It returns the element value e.Value.
-// The element must not be nil.
-func (l *ConcurrentList) Remove(e *Element) any {
-	if e.list == l {
-		// if e.list == l, l must have been initialized when e was inserted
-		// in l or l == nil (e is a zero Element) and l.remove will crash
-		l.remove(e)
+// lockPrev locks the element before e and returns it, or returns nil if e is removed.
+// The returned element is linked and its next element is e.
+func (l *ConcurrentList[T]) lockPrev(e *Element[T]) *Element[T] {
+	for {
+		prev := e.prev.Load()
+		if prev == nil {
+			return nil
+		}
+		prev.mu.Lock()
+		if prev.live() && prev.next.Load() == e {
+			return prev
+		}
+		prev.mu.Unlock()
 	}
-	return e.Value
 }
 
 // PushFront inserts a new element e with value v at the front of list l and returns e.
-func (l *ConcurrentList) PushFront(v any) *Element {
-	return l.insertValue(v, &l.root)
+func (l *ConcurrentList[T]) PushFront(v T) *Element[T] {
+	e := &Element[T]{Value: v, list: l}
+	l.head.mu.Lock()
+	first := l.head.next.Load()
+	first.mu.Lock()
+	link(e, &l.head, first)
+	first.mu.Unlock()
+	l.head.mu.Unlock()
+	l.len.Add(1)
+	return e
 }
 
 // PushBack inserts a new element e with value v at the back of list l and returns e.
-func (l *ConcurrentList) PushBack(v any) *Element {
-	return l.insertValue(v, l.root.prev)
+func (l *ConcurrentList[T]) PushBack(v T) *Element[T] {
+	e := &Element[T]{Value: v, list: l}
+	last := l.lockPrev(&l.tail)
+	l.tail.mu.Lock()
+	link(e, last, &l.tail)
+	l.tail.mu.Unlock()
+	last.mu.Unlock()
+	l.len.Add(1)
+	return e
 }
 
-// InsertBefore inserts a new element e with value v immediately before mark and returns e.
-// If mark is not an element of l, the list is not modified.
-// The mark must not be nil.
-func (l *ConcurrentList) InsertBefore(v any, mark *Element) *Element {
-	if mark.list != l {
-		return nil
+// Remove removes e from l if e is an element of list l and is not removed yet.
+// It returns the element value e.Value.
+// The element must not be nil.
+func (l *ConcurrentList[T]) Remove(e *Element[T]) T {
+	if e.list != l || e.sentinel {
+		return e.Value
 	}
-	// see comment in List.Remove about initialization of l
-	return l.insertValue(v, mark.prev)
-}
-
-// InsertAfter inserts a new element e with value v immediately after mark and returns e.
-// If mark is not an element of l, the list is not modified.
-// The mark must not be nil.
-func (l *ConcurrentList) InsertAfter(v any, mark *Element) *Element {
-	if mark.list != l {
-		return nil
+	prev := l.lockPrev(e)
+	if prev == nil {
+		return e.Value
 	}
-	// see comment in List.Remove about initialization of l
-	return l.insertValue(v, mark)
+	e.mu.Lock()
+	next := e.next.Load()
+	next.mu.Lock()
+	prev.next.Store(next)
+	next.prev.Store(prev)
+	e.prev.Store(nil) // next保留，遍历到被删除的元素时可以继续
+	next.mu.Unlock()
+	e.mu.Unlock()
+	prev.mu.Unlock()
+	l.len.Add(-1)
+	return e.Value
 }
 
 // MoveToFront moves element e to the front of list l.
-// If e is not an element of l, the list is not modified.
+// If e is not an element of l or is removed, the list is not modified.
 // The element must not be nil.
-func (l *ConcurrentList) MoveToFront(e *Element) {
-	if e.list != l || l.root.next == e {
+func (l *ConcurrentList[T]) MoveToFront(e *Element[T]) {
+	if e.list != l || e.sentinel {
 		return
 	}
-	// see comment in List.Remove about initialization of l
-	l.move(e, &l.root)
-}
+	for {
+		l.head.mu.Lock()
+		first := l.head.next.Load()
+		if first == e {
+			l.head.mu.Unlock()
+			return
+		}
+		first.mu.Lock()
 
-// MoveToBack moves element e to the back of list l.
-// If e is not an element of l, the list is not modified.
-// The element must not be nil.
-func (l *ConcurrentList) MoveToBack(e *Element) {
-	if e.list != l || l.root.prev == e {
+		prev := e.prev.Load()
+		if prev == nil { // 已经被删除
+			unlock(first, &l.head)
+			return
+		}
+		if prev != first {
+			// prev不一定在first之后，只能尝试加锁，失败时释放所有的锁后重试，避免死锁
+			if prev == &l.head || !prev.mu.TryLock() {
+				unlock(first, &l.head)
+				runtime.Gosched()
+				continue
+			}
+		}
+		if !prev.live() || prev.next.Load() != e {
+			unlockIfNot(prev, first)
+			unlock(first, &l.head)
+			continue
+		}
+
+		e.mu.Lock()
+		next := e.next.Load()
+		next.mu.Lock()
+		prev.next.Store(next)
+		next.prev.Store(prev)
+		link(e, &l.head, first)
+		unlock(next, e)
+		unlockIfNot(prev, first)
+		unlock(first, &l.head)
 		return
 	}
-	// see comment in List.Remove about initialization of l
-	l.move(e, l.root.prev)
 }
 
-// MoveBefore moves element e to its new position before mark.
-// If e or mark is not an element of l, or e == mark, the list is not modified.
-// The element and mark must not be nil.
-func (l *ConcurrentList) MoveBefore(e, mark *Element) {
-	if e.list != l || e == mark || mark.list != l {
+// MoveToBack moves element e to the back of list l.
+// If e is not an element of l or is removed, the list is not modified.
+// The element must not be nil.
+func (l *ConcurrentList[T]) MoveToBack(e *Element[T]) {
+	if e.list != l || e.sentinel {
 		return
 	}
-	l.move(e, mark.prev)
-}
+	for {
+		prev := l.lockPrev(e)
+		if prev == nil {
+			return
+		}
+		e.mu.Lock()
+		next := e.next.Load()
+		if next == &l.tail {
+			e.mu.Unlock()
+			prev.mu.Unlock()
+			return
+		}
+		next.mu.Lock()
+
+		last := l.tail.prev.Load()
+		if last != next {
+			// last不一定在next之后，只能尝试加锁
+			if !last.mu.TryLock() {
+				unlock(next, e, prev)
+				runtime.Gosched()
+				continue
+			}
+		}
+		if !last.live() || last.next.Load() != &l.tail {
+			unlockIfNot(last, next)
+			unlock(next, e, prev)
+			continue
+		}
 
-// MoveAfter moves element e to its new position after mark.
-// If e or mark is not an element of l, or e == mark, the list is not modified.
-// The element and mark must not be nil.
-func (l *ConcurrentList) MoveAfter(e, mark *Element) {
-	if e.list != l || e == mark || mark.list != l {
+		l.tail.mu.Lock()
+		prev.next.Store(next)
+		next.prev.Store(prev)
+		link(e, last, &l.tail)
+		l.tail.mu.Unlock()
+		unlockIfNot(last, next)
+		unlock(next, e, prev)
 		return
 	}
-	l.move(e, mark)
 }
 
-// PushBackList inserts a copy of another list at the back of list l.
-// The lists l and other may be the same. They must not be nil.
-func (l *ConcurrentList) PushBackList(other *ConcurrentList) {
-	for i, e := other.Len(), other.Front(); i > 0; i, e = i-1, e.Next() {
-		l.insertValue(e.Value, l.root.prev)
+func unlock[T any](locked ...*Element[T]) {
+	for _, e := range locked {
+		e.mu.Unlock()
 	}
 }
 
-// PushFrontList inserts a copy of another list at the front of list l.
-// The lists l and other may be the same. They must not be nil.
-func (l *ConcurrentList) PushFrontList(other *ConcurrentList) {
-	for i, e := other.Len(), other.Back(); i > 0; i, e = i-1, e.Prev() {
-		l.insertValue(e.Value, &l.root)
+// unlockIfNot unlocks e unless it is the adjacent element, which is unlocked separately.
+func unlockIfNot[T any](e, adjacent *Element[T]) {
+	if e != adjacent {
+		e.mu.Unlock()
 	}
 }
-
-//// Add adds a new node to the list back
-//func (l *ConcurrentList) Add(value interface{}) error {
-//	ele := &Element{Value: value}
-//	for {
-//
-//		tail := lst.tail
-//		prevTail := tail.prev
-//
-//		// Try to insert the new node before the tail
-//		ele.prev = prevTail
-//		ele.next = tail
-//
-//		if atomic.CompareAndSwapPointer(
-//			(*unsafe.Pointer)(unsafe.Pointer(&prevTail.next)),
-//			unsafe.Pointer(tail),
-//			unsafe.Pointer(ele),
-//		) {
-//			// Update tail's previous pointer
-//			atomic.CompareAndSwapPointer(
-//				(*unsafe.Pointer)(unsafe.Pointer(&tail.prev)),
-//				unsafe.Pointer(prevTail),
-//				unsafe.Pointer(ele),
-//			)
-//			return
-//		}
-//
-//		// Tail is outdated; move tail to the next node
-//		atomic.CompareAndSwapPointer(
-//			(*unsafe.Pointer)(unsafe.Pointer(&l.tail)),
-//			unsafe.Pointer(tail),
-//			unsafe.Pointer(prevTail.next),
-//		)
-//	}
-//}
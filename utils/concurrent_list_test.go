@@ -0,0 +1,167 @@
+package utils_test
+
+import (
+	fs "gaffeine/utils"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func values[T any](l *fs.ConcurrentList[T]) []T {
+	var vs []T
+	for e := l.Front(); e != nil; e = e.Next() {
+		vs = append(vs, e.Value)
+	}
+	return vs
+}
+
+// checkLinks checks that the list is the same from the front and from the back, and that Len is the length.
+func checkLinks[T any](t *testing.T, l *fs.ConcurrentList[T]) {
+	var forward, backward []*fs.Element[T]
+	for e := l.Front(); e != nil; e = e.Next() {
+		forward = append(forward, e)
+	}
+	for e := l.Back(); e != nil; e = e.Prev() {
+		backward = append([]*fs.Element[T]{e}, backward...)
+	}
+	assert.Equal(t, forward, backward)
+	assert.Equal(t, len(forward), l.Len())
+}
+
+func TestConcurrentList(t *testing.T) {
+	l := fs.NewConcurrentList[int]()
+	assert.Nil(t, l.Front())
+	assert.Nil(t, l.Back())
+
+	e2 := l.PushBack(2)
+	e1 := l.PushFront(1)
+	e3 := l.PushBack(3)
+	assert.Equal(t, []int{1, 2, 3}, values(l))
+	assert.Equal(t, e1, l.Front())
+	assert.Equal(t, e3, l.Back())
+
+	l.MoveToFront(e3)
+	assert.Equal(t, []int{3, 1, 2}, values(l))
+	l.MoveToFront(e3)
+	assert.Equal(t, []int{3, 1, 2}, values(l))
+	l.MoveToBack(e3)
+	assert.Equal(t, []int{1, 2, 3}, values(l))
+	l.MoveToBack(e3)
+	assert.Equal(t, []int{1, 2, 3}, values(l))
+
+	assert.Equal(t, 2, l.Remove(e2))
+	assert.Equal(t, []int{1, 3}, values(l))
+	assert.Equal(t, 2, l.Remove(e2)) // 重复删除不修改list
+	l.MoveToFront(e2)
+	l.MoveToBack(e2)
+	assert.Equal(t, []int{1, 3}, values(l))
+	checkLinks(t, l)
+
+	other := fs.NewConcurrentList[int]()
+	other.Remove(e1) // 不是other的元素
+	other.MoveToFront(e1)
+	assert.Equal(t, 0, other.Len())
+	assert.Equal(t, []int{1, 3}, values(l))
+}
+
+func TestConcurrentList_nextOfRemoved(t *testing.T) {
+	l := fs.NewConcurrentList[string]()
+	a, b := l.PushBack("a"), l.PushBack("b")
+	l.PushBack("c")
+
+	l.Remove(b)
+	assert.Equal(t, "c", b.Next().Value) // 遍历到被删除的元素时可以继续
+	assert.Nil(t, b.Prev())
+	assert.Equal(t, "c", a.Next().Value)
+}
+
+func TestConcurrentList_concurrentPush(t *testing.T) {
+	l := fs.NewConcurrentList[int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if i%2 == 0 {
+					l.PushBack(g*1000 + i)
+				} else {
+					l.PushFront(g*1000 + i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	checkLinks(t, l)
+	seen := make(map[int]bool)
+	for _, v := range values(l) {
+		seen[v] = true
+	}
+	assert.Equal(t, 8000, len(seen))
+}
+
+func TestConcurrentList_stress(t *testing.T) {
+	l := fs.NewConcurrentList[int]()
+	elements := make([]*fs.Element[int], 2000)
+	for i := range elements {
+		elements[i] = l.PushBack(i)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	removed := make(map[int]bool)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 5000; i++ {
+				e := elements[r.Intn(len(elements))]
+				switch r.Intn(4) {
+				case 0:
+					l.MoveToFront(e)
+				case 1:
+					l.MoveToBack(e)
+				case 2:
+					if r.Intn(10) == 0 {
+						l.Remove(e)
+						mu.Lock()
+						removed[e.Value] = true
+						mu.Unlock()
+					}
+				default:
+					for n, j := e.Next(), 0; n != nil && j < 10; n, j = n.Next(), j+1 { // 并发遍历
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	checkLinks(t, l)
+	remaining := make(map[int]bool)
+	for _, v := range values(l) {
+		assert.False(t, remaining[v], "%d appears twice", v)
+		remaining[v] = true
+	}
+	for i := range elements {
+		assert.NotEqual(t, removed[i], remaining[i], "element %d", i)
+	}
+}
+
+func BenchmarkConcurrentList_MoveToFront(b *testing.B) {
+	l := fs.NewConcurrentList[int]()
+	elements := make([]*fs.Element[int], 1024)
+	for i := range elements {
+		elements[i] = l.PushBack(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := rand.Int(); pb.Next(); i++ {
+			l.MoveToFront(elements[(i*7919)&1023])
+		}
+	})
+}
@@ -0,0 +1,273 @@
+// Package workload generates synthetic key streams for benchmarks and simulations.
+// Every random generator is deterministic given its seed, so that hit ratios are reproducible.
+package workload
+
+import (
+	"fmt"
+	"gaffeine/trace"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// Generator produces a stream of keys.
+type Generator interface {
+	Next() uint64
+}
+
+// Zipf generates keys in [0, items) following a Zipfian distribution: key i is drawn with a probability
+// proportional to 1/(i+1)^skew, so key 0 is the most popular. Skews below one, such as YCSB's 0.99,
+// use the algorithm of Gray et al. [1], skews above one use math/rand.Zipf.
+//
+// [1] Quickly Generating Billion-Record Synthetic Databases
+// https://dl.acm.org/doi/10.1145/191843.191886
+type Zipf struct {
+	r     *rand.Rand
+	zipf  *rand.Zipf // skew > 1
+	items uint64
+	skew  float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+// NewZipf returns a Zipfian generator. It panics if skew is not positive or equals one.
+func NewZipf(seed int64, items uint64, skew float64) *Zipf {
+	if skew <= 0 || skew == 1 {
+		panic(fmt.Sprintf("not support zipf skew %v, it must be in (0, 1) or (1, +Inf)", skew))
+	}
+	if items == 0 {
+		items = 1
+	}
+	z := &Zipf{r: rand.New(rand.NewSource(seed)), items: items, skew: skew}
+	if skew > 1 {
+		z.zipf = rand.NewZipf(z.r, skew, 1, items-1)
+		return z
+	}
+	zeta2 := zeta(2, skew)
+	z.alpha = 1 / (1 - skew)
+	z.zetan = zeta(items, skew)
+	z.eta = (1 - math.Pow(2/float64(items), 1-skew)) / (1 - zeta2/z.zetan)
+	return z
+}
+
+func (z *Zipf) Next() uint64 {
+	if z.zipf != nil {
+		return z.zipf.Uint64()
+	}
+	u := z.r.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+math.Pow(0.5, z.skew) {
+		return 1
+	}
+	key := uint64(float64(z.items) * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	if key >= z.items {
+		key = z.items - 1
+	}
+	return key
+}
+
+// zeta returns the sum of 1/i^theta for i in [1, n].
+func zeta(n uint64, theta float64) float64 {
+	sum := 0.0
+	for i := uint64(1); i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), theta)
+	}
+	return sum
+}
+
+// ScrambledZipf is a Zipf generator whose popular keys are spread over [0, items) by hashing,
+// instead of being the smallest keys, as YCSB's scrambled Zipfian generator.
+type ScrambledZipf struct {
+	zipf  *Zipf
+	items uint64
+}
+
+func NewScrambledZipf(seed int64, items uint64, skew float64) *ScrambledZipf {
+	zipf := NewZipf(seed, items, skew)
+	return &ScrambledZipf{zipf: zipf, items: zipf.items}
+}
+
+func (z *ScrambledZipf) Next() uint64 {
+	return fnv64(z.zipf.Next()) % z.items
+}
+
+// fnv64 is the FNV-1a hash of the 8 bytes of x.
+func fnv64(x uint64) uint64 {
+	hash := uint64(0xcbf29ce484222325)
+	for i := 0; i < 8; i++ {
+		hash ^= x & 0xff
+		hash *= 0x100000001b3
+		x >>= 8
+	}
+	return hash
+}
+
+// Uniform generates keys in [0, items) with the same probability.
+type Uniform struct {
+	r     *rand.Rand
+	items uint64
+}
+
+func NewUniform(seed int64, items uint64) *Uniform {
+	if items == 0 {
+		items = 1
+	}
+	return &Uniform{r: rand.New(rand.NewSource(seed)), items: items}
+}
+
+func (u *Uniform) Next() uint64 {
+	return uint64(u.r.Int63n(int64(u.items)))
+}
+
+// Hotspot generates keys in [0, items), where the first hotFraction of the keys receive hotOpFraction of the requests,
+// e.g. 20% of the keys receive 80% of the requests. Keys are uniform inside the hot and the cold sets.
+type Hotspot struct {
+	r             *rand.Rand
+	items         uint64
+	hotItems      uint64
+	hotOpFraction float64
+}
+
+func NewHotspot(seed int64, items uint64, hotFraction, hotOpFraction float64) *Hotspot {
+	if items == 0 {
+		items = 1
+	}
+	hotItems := uint64(float64(items) * hotFraction)
+	if hotItems == 0 {
+		hotItems = 1
+	} else if hotItems > items {
+		hotItems = items
+	}
+	return &Hotspot{r: rand.New(rand.NewSource(seed)), items: items, hotItems: hotItems, hotOpFraction: hotOpFraction}
+}
+
+func (h *Hotspot) Next() uint64 {
+	if h.r.Float64() < h.hotOpFraction || h.hotItems == h.items {
+		return uint64(h.r.Int63n(int64(h.hotItems)))
+	}
+	return h.hotItems + uint64(h.r.Int63n(int64(h.items-h.hotItems)))
+}
+
+// Scan generates increasing keys from start, which are never accessed again.
+type Scan struct {
+	next uint64
+}
+
+func NewScan(start uint64) *Scan {
+	return &Scan{next: start}
+}
+
+func (s *Scan) Next() uint64 {
+	key := s.next
+	s.next++
+	return key
+}
+
+// Loop repeats the keys [0, items) in order.
+type Loop struct {
+	items, next uint64
+}
+
+func NewLoop(items uint64) *Loop {
+	if items == 0 {
+		items = 1
+	}
+	return &Loop{items: items}
+}
+
+func (l *Loop) Next() uint64 {
+	key := l.next
+	l.next = (l.next + 1) % l.items
+	return key
+}
+
+// Phases switches to the next generator every `every` requests, going back to the first one after the last,
+// e.g. to shift the popular keys or to interleave scans with a Zipfian workload.
+type Phases struct {
+	generators []Generator
+	every      int
+	current    int
+	count      int
+}
+
+// NewPhases returns a Phases generator. It panics if there is no generator.
+func NewPhases(every int, generators ...Generator) *Phases {
+	if len(generators) == 0 {
+		panic("phases need at least one generator")
+	}
+	if every <= 0 {
+		every = 1
+	}
+	return &Phases{generators: generators, every: every}
+}
+
+func (p *Phases) Next() uint64 {
+	if p.count == p.every {
+		p.count = 0
+		p.current = (p.current + 1) % len(p.generators)
+	}
+	p.count++
+	return p.generators[p.current].Next()
+}
+
+// Mix draws every request from one of the generators, chosen randomly according to its weight.
+type Mix struct {
+	r          *rand.Rand
+	generators []Generator
+	cumulative []float64 // 累计的权重
+}
+
+func NewMix(seed int64, weights []float64, generators ...Generator) *Mix {
+	if len(weights) != len(generators) {
+		panic(fmt.Sprintf("%d weights for %d generators", len(weights), len(generators)))
+	}
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, weight := range weights {
+		total += weight
+		cumulative[i] = total
+	}
+	return &Mix{r: rand.New(rand.NewSource(seed)), generators: generators, cumulative: cumulative}
+}
+
+func (m *Mix) Next() uint64 {
+	u := m.r.Float64() * m.cumulative[len(m.cumulative)-1]
+	for i, c := range m.cumulative {
+		if u < c {
+			return m.generators[i].Next()
+		}
+	}
+	return m.generators[len(m.generators)-1].Next()
+}
+
+// Keys returns the next n keys of g.
+func Keys(g Generator, n int) []uint64 {
+	keys := make([]uint64, n)
+	for i := range keys {
+		keys[i] = g.Next()
+	}
+	return keys
+}
+
+type generatorTrace struct {
+	g         Generator
+	remaining int
+}
+
+// Trace returns a trace of the next requests keys of g, e.g. to replay a workload with the simulator.
+func Trace(g Generator, requests int) trace.Reader {
+	return &generatorTrace{g: g, remaining: requests}
+}
+
+func (t *generatorTrace) Next() (trace.Event, error) {
+	if t.remaining <= 0 {
+		return trace.Event{}, io.EOF
+	}
+	t.remaining--
+	return trace.Event{Key: strconv.FormatUint(t.g.Next(), 10), Size: 1}, nil
+}
@@ -0,0 +1,122 @@
+package workload_test
+
+import (
+	"gaffeine/workload"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func counts(keys []uint64) map[uint64]int {
+	c := make(map[uint64]int)
+	for _, key := range keys {
+		c[key]++
+	}
+	return c
+}
+
+func TestDeterministic(t *testing.T) {
+	generators := map[string]func(seed int64) workload.Generator{
+		"zipf":          func(seed int64) workload.Generator { return workload.NewZipf(seed, 1000, 0.99) },
+		"zipf1.2":       func(seed int64) workload.Generator { return workload.NewZipf(seed, 1000, 1.2) },
+		"scrambledZipf": func(seed int64) workload.Generator { return workload.NewScrambledZipf(seed, 1000, 0.99) },
+		"uniform":       func(seed int64) workload.Generator { return workload.NewUniform(seed, 1000) },
+		"hotspot":       func(seed int64) workload.Generator { return workload.NewHotspot(seed, 1000, 0.2, 0.8) },
+		"mix": func(seed int64) workload.Generator {
+			return workload.NewMix(seed, []float64{1, 1}, workload.NewUniform(seed, 10), workload.NewScan(100))
+		},
+	}
+	for name, newGenerator := range generators {
+		keys := workload.Keys(newGenerator(42), 1000)
+		assert.Equal(t, keys, workload.Keys(newGenerator(42), 1000), name)
+		assert.NotEqual(t, keys, workload.Keys(newGenerator(43), 1000), name)
+	}
+}
+
+func TestZipf(t *testing.T) {
+	for _, skew := range []float64{0.5, 0.99, 1.2} {
+		keys := workload.Keys(workload.NewZipf(1, 1000, skew), 100_000)
+		c := counts(keys)
+		for key := range c {
+			assert.Less(t, key, uint64(1000))
+		}
+		// 越小的key越热
+		assert.Greater(t, c[0], c[1], skew)
+		assert.Greater(t, c[1], c[10], skew)
+		assert.Greater(t, c[10], c[500], skew)
+	}
+
+	// 倾斜度越大，最热的key占比越高
+	low := counts(workload.Keys(workload.NewZipf(1, 1000, 0.5), 100_000))
+	high := counts(workload.Keys(workload.NewZipf(1, 1000, 0.99), 100_000))
+	assert.Greater(t, high[0], low[0])
+
+	assert.Panics(t, func() { workload.NewZipf(1, 1000, 1) })
+	assert.Panics(t, func() { workload.NewZipf(1, 1000, 0) })
+}
+
+func TestScrambledZipf(t *testing.T) {
+	c := counts(workload.Keys(workload.NewScrambledZipf(1, 1000, 0.99), 100_000))
+	hottest, hottestCount := uint64(0), 0
+	for key, count := range c {
+		assert.Less(t, key, uint64(1000))
+		if count > hottestCount {
+			hottest, hottestCount = key, count
+		}
+	}
+	assert.NotEqual(t, uint64(0), hottest) // 最热的key被打散了
+	assert.Greater(t, hottestCount, 100_000/100)
+}
+
+func TestUniform(t *testing.T) {
+	c := counts(workload.Keys(workload.NewUniform(1, 10), 100_000))
+	assert.Equal(t, 10, len(c))
+	for _, count := range c {
+		assert.InDelta(t, 10_000, count, 500)
+	}
+}
+
+func TestHotspot(t *testing.T) {
+	keys := workload.Keys(workload.NewHotspot(1, 1000, 0.2, 0.8), 100_000)
+	hot := 0
+	for _, key := range keys {
+		assert.Less(t, key, uint64(1000))
+		if key < 200 {
+			hot++
+		}
+	}
+	assert.InDelta(t, 80_000, hot, 1000)
+}
+
+func TestScanAndLoop(t *testing.T) {
+	assert.Equal(t, []uint64{5, 6, 7, 8}, workload.Keys(workload.NewScan(5), 4))
+	assert.Equal(t, []uint64{0, 1, 2, 0, 1}, workload.Keys(workload.NewLoop(3), 5))
+}
+
+func TestPhases(t *testing.T) {
+	g := workload.NewPhases(2, workload.NewLoop(1), workload.NewScan(100))
+	assert.Equal(t, []uint64{0, 0, 100, 101, 0, 0, 102}, workload.Keys(g, 7))
+	assert.Panics(t, func() { workload.NewPhases(2) })
+}
+
+func TestMix(t *testing.T) {
+	keys := workload.Keys(workload.NewMix(1, []float64{3, 1}, workload.NewLoop(1), workload.NewScan(100)), 10_000)
+	zeros := counts(keys)[0]
+	assert.InDelta(t, 7_500, zeros, 300)
+	assert.Panics(t, func() { workload.NewMix(1, []float64{1}) })
+}
+
+func TestTrace(t *testing.T) {
+	r := workload.Trace(workload.NewLoop(2), 3)
+	keys := make([]string, 0)
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), event.Size)
+		keys = append(keys, event.Key)
+	}
+	assert.Equal(t, []string{"0", "1", "0"}, keys)
+}